@@ -0,0 +1,48 @@
+package blobstore
+
+import (
+	"context"
+	"path"
+)
+
+// ObjectClient is the part of an S3 compatible API that S3Store needs.
+// GetObject and DeleteObject must return ErrNotFound for a missing key.
+type ObjectClient interface {
+	PutObject(ctx context.Context, bucket, key string, body []byte) error
+	GetObject(ctx context.Context, bucket, key string) ([]byte, error)
+	DeleteObject(ctx context.Context, bucket, key string) error
+}
+
+// S3Store stores blobs as objects in Bucket, under Prefix.
+type S3Store struct {
+	Client ObjectClient
+	Bucket string
+	Prefix string
+}
+
+func NewS3Store(client ObjectClient, bucket, prefix string) *S3Store {
+	return &S3Store{Client: client, Bucket: bucket, Prefix: prefix}
+}
+
+func (s *S3Store) objectKey(key string) string {
+	return path.Join(s.Prefix, key[:2], key)
+}
+
+func (s *S3Store) Put(ctx context.Context, data []byte) (string, error) {
+	key := Key(data)
+	return key, s.Client.PutObject(ctx, s.Bucket, s.objectKey(key), data)
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	if !validKey(key) {
+		return nil, ErrNotFound
+	}
+	return s.Client.GetObject(ctx, s.Bucket, s.objectKey(key))
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrNotFound
+	}
+	return s.Client.DeleteObject(ctx, s.Bucket, s.objectKey(key))
+}
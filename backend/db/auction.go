@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// AuctionRepository starts and reads auctions. Bids and the end of auctions
+// move money, so they are made by TradeRepository.
+type AuctionRepository interface {
+	// StartAuction puts a draft item on sale by auction, at the start price
+	// of a. It returns ErrInvalidItemStatus when the item is not a draft.
+	StartAuction(ctx context.Context, a domain.Auction) (int64, error)
+	// GetAuction returns the latest auction of the item.
+	GetAuction(ctx context.Context, itemID int32) (domain.Auction, error)
+	// GetBids lists the bids of an auction, highest first.
+	GetBids(ctx context.Context, auctionID int64, limit, offset int) ([]domain.Bid, error)
+	CountBids(ctx context.Context, auctionID int64) (int64, error)
+	// GetEndedAuctions lists the open auctions that ended before the given
+	// time, oldest first.
+	GetEndedAuctions(ctx context.Context, before string) ([]domain.Auction, error)
+}
+
+type AuctionDBRepository struct {
+	*DB
+}
+
+func NewAuctionRepository(db *DB) AuctionRepository {
+	return &AuctionDBRepository{DB: db}
+}
+
+var (
+	ErrAuctionNotFound   = errors.New("auction not found")
+	ErrAuctionClosed     = errors.New("auction is closed")
+	ErrAuctionNotEnded   = errors.New("auction has not ended")
+	ErrItemAuctioned     = errors.New("item is sold by auction")
+	ErrBidTooLow         = errors.New("bid is too low")
+	ErrInvalidItemStatus = errors.New("invalid item status")
+)
+
+const auctionColumns = `id, item_id, seller_id, start_price, min_increment, ends_at, status, created_at`
+
+// getAuction returns the first auction matching where, with its highest bid.
+func getAuction(ctx context.Context, q queryer, where string, args ...any) (domain.Auction, error) {
+	var a domain.Auction
+	row := q.QueryRowContext(ctx, "SELECT "+auctionColumns+" FROM auctions WHERE "+where, args...)
+	err := row.Scan(&a.ID, &a.ItemID, &a.SellerID, &a.StartPrice, &a.MinIncrement, &a.EndsAt, &a.Status, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return domain.Auction{}, ErrAuctionNotFound
+	}
+	if err != nil {
+		return domain.Auction{}, err
+	}
+
+	bid, err := highestBid(ctx, q, a.ID)
+	switch err {
+	case nil:
+		a.HighestBid, a.HighestBidderID = bid.Amount, bid.BidderID
+	case sql.ErrNoRows:
+	default:
+		return domain.Auction{}, err
+	}
+	if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM bids WHERE auction_id = ?", a.ID).Scan(&a.BidCount); err != nil {
+		return domain.Auction{}, err
+	}
+	return a, nil
+}
+
+// highestBid returns the bid of an auction that is held or has won, or
+// sql.ErrNoRows when nobody has bid.
+func highestBid(ctx context.Context, q queryer, auctionID int64) (domain.Bid, error) {
+	var b domain.Bid
+	row := q.QueryRowContext(ctx, "SELECT id, auction_id, bidder_id, amount, status, created_at FROM bids WHERE auction_id = ? AND status IN (?, ?) ORDER BY amount DESC LIMIT 1",
+		auctionID, domain.BidStatusHeld, domain.BidStatusWon)
+	err := row.Scan(&b.ID, &b.AuctionID, &b.BidderID, &b.Amount, &b.Status, &b.CreatedAt)
+	return b, err
+}
+
+// checkNotAuctioned returns ErrItemAuctioned when the item is sold by an
+// open auction, which leaves no room for a fixed price.
+func checkNotAuctioned(ctx context.Context, q queryer, itemID int32) error {
+	var count int64
+	row := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM auctions WHERE item_id = ? AND status = ?", itemID, domain.AuctionStatusOpen)
+	if err := row.Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrItemAuctioned
+	}
+	return nil
+}
+
+func (r *AuctionDBRepository) StartAuction(ctx context.Context, a domain.Auction) (int64, error) {
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		var status domain.ItemStatus
+		if err := tx.QueryRowContext(ctx, "SELECT status FROM items WHERE id = ?", a.ItemID).Scan(&status); err != nil {
+			return err
+		}
+		// paused items are resumed rather than auctioned
+		if status != domain.ItemStatusInitial {
+			return ErrInvalidItemStatus
+		}
+		if err := moveItem(ctx, tx, a.ItemID, domain.ItemStatusOnSale, domain.ItemActorSeller, a.SellerID, ErrInvalidItemStatus); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE items SET price = ? WHERE id = ?", a.StartPrice, a.ItemID); err != nil {
+			return err
+		}
+		var err error
+		id, err = insertID(ctx, tx, r.Dialect, "INSERT INTO auctions (item_id, seller_id, start_price, min_increment, ends_at, status) VALUES (?, ?, ?, ?, ?, ?)",
+			a.ItemID, a.SellerID, a.StartPrice, a.MinIncrement, a.EndsAt, domain.AuctionStatusOpen)
+		return err
+	})
+	return id, err
+}
+
+func (r *AuctionDBRepository) GetAuction(ctx context.Context, itemID int32) (domain.Auction, error) {
+	return getAuction(ctx, r.DB, "item_id = ? ORDER BY id DESC LIMIT 1", itemID)
+}
+
+func (r *AuctionDBRepository) GetBids(ctx context.Context, auctionID int64, limit, offset int) ([]domain.Bid, error) {
+	rows, err := r.QueryContext(ctx, `
+		SELECT bids.id, bids.auction_id, auctions.item_id, bids.bidder_id, bids.amount, bids.status, bids.created_at
+		FROM bids JOIN auctions ON auctions.id = bids.auction_id
+		WHERE bids.auction_id = ? ORDER BY bids.amount DESC, bids.id DESC LIMIT ? OFFSET ?`, auctionID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bids := make([]domain.Bid, 0)
+	for rows.Next() {
+		var b domain.Bid
+		if err := rows.Scan(&b.ID, &b.AuctionID, &b.ItemID, &b.BidderID, &b.Amount, &b.Status, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bids = append(bids, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return bids, nil
+}
+
+func (r *AuctionDBRepository) CountBids(ctx context.Context, auctionID int64) (int64, error) {
+	row := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM bids WHERE auction_id = ?", auctionID)
+
+	var count int64
+	return count, row.Scan(&count)
+}
+
+func (r *AuctionDBRepository) GetEndedAuctions(ctx context.Context, before string) ([]domain.Auction, error) {
+	rows, err := r.QueryContext(ctx, "SELECT id FROM auctions WHERE status = ? AND ends_at <= ? ORDER BY id", domain.AuctionStatusOpen, before)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	auctions := make([]domain.Auction, 0, len(ids))
+	for _, id := range ids {
+		a, err := getAuction(ctx, r.DB, "id = ?", id)
+		if err != nil {
+			return nil, err
+		}
+		auctions = append(auctions, a)
+	}
+	return auctions, nil
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// CancellationRepository stores the requests to cancel orders. Approved
+// requests are resolved by TradeRepository, which refunds the buyer.
+type CancellationRepository interface {
+	// AddCancellation requests the cancellation of an order. It returns
+	// ErrCancellationRequested when the order already has a requested one.
+	AddCancellation(ctx context.Context, cancellation domain.Cancellation) (int64, error)
+	// GetLatestCancellation returns the newest cancellation of an order.
+	GetLatestCancellation(ctx context.Context, orderID int64) (domain.Cancellation, error)
+	RejectCancellation(ctx context.Context, id int64) error
+}
+
+type CancellationDBRepository struct {
+	*DB
+}
+
+func NewCancellationRepository(db *DB) CancellationRepository {
+	return &CancellationDBRepository{DB: db}
+}
+
+var (
+	ErrCancellationNotFound     = errors.New("cancellation not found")
+	ErrCancellationRequested    = errors.New("cancellation is already requested")
+	ErrCancellationNotRequested = errors.New("cancellation is not requested")
+)
+
+func (r *CancellationDBRepository) AddCancellation(ctx context.Context, cancellation domain.Cancellation) (int64, error) {
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		var count int64
+		row := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM cancellations WHERE order_id = ? AND status = ?", cancellation.OrderID, domain.CancellationStatusRequested)
+		if err := row.Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrCancellationRequested
+		}
+
+		var err error
+		id, err = insertID(ctx, tx, r.Dialect, "INSERT INTO cancellations (order_id, requested_by, reason, status) VALUES (?, ?, ?, ?)",
+			cancellation.OrderID, cancellation.RequestedBy, cancellation.Reason, domain.CancellationStatusRequested)
+		return err
+	})
+	return id, err
+}
+
+func (r *CancellationDBRepository) GetLatestCancellation(ctx context.Context, orderID int64) (domain.Cancellation, error) {
+	row := r.QueryRowContext(ctx, `
+		SELECT id, order_id, requested_by, reason, status, created_at, updated_at
+		FROM cancellations WHERE order_id = ? ORDER BY id DESC LIMIT 1`, orderID)
+
+	var c domain.Cancellation
+	err := row.Scan(&c.ID, &c.OrderID, &c.RequestedBy, &c.Reason, &c.Status, &c.CreatedAt, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return domain.Cancellation{}, ErrCancellationNotFound
+	}
+	return c, err
+}
+
+func (r *CancellationDBRepository) RejectCancellation(ctx context.Context, id int64) error {
+	rst, err := r.ExecContext(ctx, "UPDATE cancellations SET status = ?, updated_at = ? WHERE id = ? AND status = ?",
+		domain.CancellationStatusRejected, now(), id, domain.CancellationStatusRequested)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(rst, ErrCancellationNotRequested)
+}
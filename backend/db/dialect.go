@@ -0,0 +1,99 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect holds what differs between the supported SQL backends. Queries are
+// written with `?` placeholders and rebound for the backend, and migrations
+// may use the macros below instead of backend specific column definitions.
+type Dialect struct {
+	Name       string
+	DriverName string
+
+	// numberedPlaceholders is true when the backend expects $1, $2, ...
+	numberedPlaceholders bool
+	// returning is true when INSERT ... RETURNING is supported.
+	returning bool
+	// fts5 is true when items are indexed in the items_fts table.
+	fts5 bool
+	// migrations is the suffix of the backend specific migration files to
+	// use.
+	migrations string
+	macros     *strings.Replacer
+}
+
+var (
+	SQLite = Dialect{
+		Name:       "sqlite3",
+		DriverName: "sqlite3",
+		returning:  true,
+		fts5:       true,
+		migrations: "sqlite3",
+		macros: strings.NewReplacer(
+			"{{serial}}", "integer primary key autoincrement",
+			"{{blob}}", "blob",
+			"{{timestamp}}", "text NOT NULL DEFAULT (DATETIME('now', 'localtime'))",
+		),
+	}
+	Postgres = Dialect{
+		Name:                 "postgres",
+		DriverName:           "postgres",
+		numberedPlaceholders: true,
+		returning:            true,
+		migrations:           "postgres",
+		macros: strings.NewReplacer(
+			"{{serial}}", "serial primary key",
+			"{{blob}}", "bytea",
+			"{{timestamp}}", "text NOT NULL DEFAULT (to_char(localtimestamp, 'YYYY-MM-DD HH24:MI:SS'))",
+		),
+	}
+	MySQL = Dialect{
+		Name:       "mysql",
+		DriverName: "mysql",
+		migrations: "mysql",
+		macros: strings.NewReplacer(
+			"{{serial}}", "integer primary key auto_increment",
+			"{{blob}}", "mediumblob",
+			"{{timestamp}}", "varchar(19) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s'))",
+		),
+	}
+)
+
+// withoutFTS5 returns the SQLite dialect for a build without FTS5. Items are
+// searched with LIKE as on the other backends, and the SQLite specific
+// migrations, which only maintain items_fts, are left out.
+func (d Dialect) withoutFTS5() Dialect {
+	d.fts5 = false
+	d.migrations = ""
+	return d
+}
+
+// Rebind converts the `?` placeholders in query to the backend's style.
+func (d Dialect) Rebind(query string) string {
+	if !d.numberedPlaceholders {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	inQuote := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == '?' && !inQuote:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Render expands the migration macros in sql.
+func (d Dialect) Render(sql string) string {
+	return d.macros.Replace(sql)
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// ItemFilter narrows down a search. Zero values do not filter.
+type ItemFilter struct {
+	CategoryIDs []int64
+	MinPrice    int64
+	MaxPrice    int64
+	// Statuses defaults to on sale and sold out items, drafts are never
+	// searched.
+	Statuses []domain.ItemStatus
+	SellerID int64
+	// CreatedAfter is in domain.TimestampLayout.
+	CreatedAfter string
+}
+
+// PriceBuckets are the lower bounds of the price facet buckets.
+var PriceBuckets = []int64{0, 1000, 5000, 10000, 50000}
+
+// UncategorizedName names the category facet, with id 0, of the items whose
+// category does not exist.
+const UncategorizedName = "uncategorized"
+
+type CategoryFacet struct {
+	Category domain.Category
+	Count    int64
+}
+
+type PriceFacet struct {
+	Min int64
+	// Max is exclusive, 0 for the last bucket.
+	Max   int64
+	Count int64
+}
+
+type ItemFacets struct {
+	Categories []CategoryFacet
+	Prices     []PriceFacet
+}
+
+// apply narrows q down by f. The category and price conditions can be left
+// out so that their facets count the items of every category and price.
+func (f ItemFilter) apply(q itemQuery, withCategory, withPrice bool) itemQuery {
+	conds := []string{"(" + q.where + ")"}
+	args := append([]any{}, q.args...)
+
+	statuses := f.Statuses
+	if len(statuses) == 0 {
+		statuses = domain.PublicItemStatuses
+	}
+	conds = append(conds, "items.status IN ("+placeholders(len(statuses))+")")
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	if withCategory && len(f.CategoryIDs) > 0 {
+		conds = append(conds, "items.category_id IN ("+placeholders(len(f.CategoryIDs))+")")
+		for _, id := range f.CategoryIDs {
+			args = append(args, id)
+		}
+	}
+	if withPrice && f.MinPrice > 0 {
+		conds = append(conds, "items.price >= ?")
+		args = append(args, f.MinPrice)
+	}
+	if withPrice && f.MaxPrice > 0 {
+		conds = append(conds, "items.price <= ?")
+		args = append(args, f.MaxPrice)
+	}
+	if f.SellerID != 0 {
+		conds = append(conds, "items.seller_id = ?")
+		args = append(args, f.SellerID)
+	}
+	if f.CreatedAfter != "" {
+		conds = append(conds, "items.created_at > ?")
+		args = append(args, f.CreatedAfter)
+	}
+
+	q.where = strings.Join(conds, " AND ")
+	q.args = args
+	return q
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// searchFacets counts the items matching q by category and by price bucket.
+// Like in most shops, each facet ignores its own filter.
+func searchFacets(ctx context.Context, db queryer, q itemQuery, f ItemFilter) (ItemFacets, error) {
+	if q.from == "" {
+		q.from = itemsWithCat
+	}
+	facets := ItemFacets{Categories: []CategoryFacet{}, Prices: make([]PriceFacet, len(PriceBuckets))}
+
+	cq := f.apply(q, false, true)
+	rows, err := db.QueryContext(ctx, "SELECT category.id, category.name, COUNT(*) FROM "+cq.from+" WHERE "+cq.where+
+		" GROUP BY category.id, category.name ORDER BY category.id", cq.args...)
+	if err != nil {
+		return ItemFacets{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		// items whose category is gone are counted as uncategorized
+		var id sql.NullInt64
+		var name sql.NullString
+		var facet CategoryFacet
+		if err := rows.Scan(&id, &name, &facet.Count); err != nil {
+			return ItemFacets{}, err
+		}
+		facet.Category = domain.Category{ID: id.Int64, Name: name.String}
+		if !id.Valid {
+			facet.Category.Name = UncategorizedName
+		}
+		facets.Categories = append(facets.Categories, facet)
+	}
+	if err := rows.Err(); err != nil {
+		return ItemFacets{}, err
+	}
+
+	// count every bucket in one pass
+	pq := f.apply(q, true, false)
+	sums := make([]string, len(PriceBuckets))
+	counts := make([]any, len(PriceBuckets))
+	var args []any
+	for i, lower := range PriceBuckets {
+		facets.Prices[i].Min = lower
+		cond := "items.price >= ?"
+		args = append(args, lower)
+		if i+1 < len(PriceBuckets) {
+			facets.Prices[i].Max = PriceBuckets[i+1]
+			cond += " AND items.price < ?"
+			args = append(args, PriceBuckets[i+1])
+		}
+		sums[i] = "COALESCE(SUM(CASE WHEN " + cond + " THEN 1 ELSE 0 END), 0)"
+		counts[i] = &facets.Prices[i].Count
+	}
+	args = append(args, pq.args...)
+	err = db.QueryRowContext(ctx, "SELECT "+strings.Join(sums, ", ")+" FROM "+pq.from+" WHERE "+pq.where, args...).Scan(counts...)
+	return facets, err
+}
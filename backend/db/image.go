@@ -0,0 +1,371 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/blobstore"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// ItemImageRepository manages the ordered images of an item. Exactly one
+// image of an item with images is its cover.
+type ItemImageRepository interface {
+	AddImages(ctx context.Context, itemID int32, images []domain.ItemImage) ([]domain.ItemImage, error)
+	GetImages(ctx context.Context, itemID int32) ([]domain.ItemImage, error)
+	GetImage(ctx context.Context, itemID int32, imageID int64) (domain.ItemImage, error)
+	GetCoverImage(ctx context.Context, itemID int32) (domain.ItemImage, error)
+	ReorderImages(ctx context.Context, itemID int32, imageIDs []int64) error
+	SetCoverImage(ctx context.Context, itemID int32, imageID int64) error
+	DeleteImage(ctx context.Context, itemID int32, imageID int64) error
+	SetRenditions(ctx context.Context, imageID int64, thumbnailKey, mediumKey string) error
+	IsImageKeyUsed(ctx context.Context, key string) (bool, error)
+	// ClaimImageKeys takes keys off the blobs queued for deletion. It is
+	// called before the blobs are stored again, so that a sweep running at
+	// the same time either finishes first or leaves them alone.
+	ClaimImageKeys(ctx context.Context, keys []string) error
+	// GetDeletedImageKeys lists the keys of the blobs queued for deletion
+	// before the given time, oldest first.
+	GetDeletedImageKeys(ctx context.Context, deletedBefore string) ([]string, error)
+	// SweepImageKey takes key off the queue if it was queued before the
+	// given time, and deletes its blob from store unless an image still
+	// refers to it. It reports whether the blob was deleted.
+	SweepImageKey(ctx context.Context, store blobstore.Store, key, deletedBefore string) (bool, error)
+}
+
+type ItemImageDBRepository struct {
+	*DB
+}
+
+func NewItemImageRepository(db *DB) ItemImageRepository {
+	return &ItemImageDBRepository{DB: db}
+}
+
+var (
+	ErrTooManyImages   = errors.New("too many images")
+	ErrImageNotFound   = errors.New("image not found")
+	ErrLastImage       = errors.New("can not delete the last image")
+	ErrInvalidOrdering = errors.New("image ids must list every image of the item once")
+)
+
+const selectItemImages = "SELECT id, item_id, image_key, COALESCE(thumbnail_key, ''), COALESCE(medium_key, ''), position, is_cover, created_at FROM item_images "
+
+func scanItemImage(row interface{ Scan(...any) error }) (domain.ItemImage, error) {
+	var img domain.ItemImage
+	err := row.Scan(&img.ID, &img.ItemID, &img.ImageKey, &img.ThumbnailKey, &img.MediumKey, &img.Position, &img.IsCover, &img.CreatedAt)
+	return img, err
+}
+
+func getItemImages(ctx context.Context, q queryer, itemID int32) ([]domain.ItemImage, error) {
+	rows, err := q.QueryContext(ctx, selectItemImages+"WHERE item_id = ? ORDER BY position, id", itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make([]domain.ItemImage, 0)
+	for rows.Next() {
+		img, err := scanItemImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// addItemImages appends images after the existing images of the item. Only
+// the keys of images are used. The first image of an item becomes its cover.
+func addItemImages(ctx context.Context, tx *Tx, itemID int32, images []domain.ItemImage) ([]domain.ItemImage, error) {
+	existing, err := getItemImages(ctx, tx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing)+len(images) > domain.MaxItemImages {
+		return nil, ErrTooManyImages
+	}
+
+	position := 0
+	if len(existing) > 0 {
+		position = existing[len(existing)-1].Position + 1
+	}
+	for i, img := range images {
+		isCover := 0
+		if len(existing) == 0 && i == 0 {
+			isCover = 1
+		}
+		if _, err := insertID(ctx, tx, tx.Dialect, "INSERT INTO item_images (item_id, image_key, thumbnail_key, medium_key, position, is_cover) VALUES (?, ?, ?, ?, ?, ?)",
+			itemID, img.ImageKey, nullString(img.ThumbnailKey), nullString(img.MediumKey), position+i, isCover); err != nil {
+			return nil, err
+		}
+	}
+	if err := touchItem(ctx, tx, itemID); err != nil {
+		return nil, err
+	}
+	added, err := getItemImages(ctx, tx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	return added[len(existing):], nil
+}
+
+func (r *ItemImageDBRepository) AddImages(ctx context.Context, itemID int32, images []domain.ItemImage) ([]domain.ItemImage, error) {
+	var added []domain.ItemImage
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		var err error
+		added, err = addItemImages(ctx, tx, itemID, images)
+		return err
+	})
+	return added, err
+}
+
+func (r *ItemImageDBRepository) GetImages(ctx context.Context, itemID int32) ([]domain.ItemImage, error) {
+	return getItemImages(ctx, r.DB, itemID)
+}
+
+func (r *ItemImageDBRepository) GetImage(ctx context.Context, itemID int32, imageID int64) (domain.ItemImage, error) {
+	img, err := scanItemImage(r.QueryRowContext(ctx, selectItemImages+"WHERE item_id = ? AND id = ?", itemID, imageID))
+	if err == sql.ErrNoRows {
+		return img, ErrImageNotFound
+	}
+	return img, err
+}
+
+func (r *ItemImageDBRepository) GetCoverImage(ctx context.Context, itemID int32) (domain.ItemImage, error) {
+	img, err := scanItemImage(r.QueryRowContext(ctx, selectItemImages+"WHERE item_id = ? AND is_cover = 1", itemID))
+	if err == sql.ErrNoRows {
+		return img, ErrImageNotFound
+	}
+	return img, err
+}
+
+func (r *ItemImageDBRepository) ReorderImages(ctx context.Context, itemID int32, imageIDs []int64) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		images, err := getItemImages(ctx, tx, itemID)
+		if err != nil {
+			return err
+		}
+		if len(images) != len(imageIDs) {
+			return ErrInvalidOrdering
+		}
+		remaining := map[int64]bool{}
+		for _, img := range images {
+			remaining[img.ID] = true
+		}
+		for _, id := range imageIDs {
+			if !remaining[id] {
+				return ErrInvalidOrdering
+			}
+			delete(remaining, id)
+		}
+
+		for position, id := range imageIDs {
+			if _, err := tx.ExecContext(ctx, "UPDATE item_images SET position = ? WHERE id = ?", position, id); err != nil {
+				return err
+			}
+		}
+		return touchItem(ctx, tx, itemID)
+	})
+}
+
+func (r *ItemImageDBRepository) SetCoverImage(ctx context.Context, itemID int32, imageID int64) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		rst, err := tx.ExecContext(ctx, "UPDATE item_images SET is_cover = 1 WHERE item_id = ? AND id = ?", itemID, imageID)
+		if err != nil {
+			return err
+		}
+		if err := expectOneRow(rst, ErrImageNotFound); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE item_images SET is_cover = 0 WHERE item_id = ? AND id != ?", itemID, imageID); err != nil {
+			return err
+		}
+		return touchItem(ctx, tx, itemID)
+	})
+}
+
+// DeleteImage removes an image from the item. When the cover is deleted, the
+// first remaining image becomes the cover. The blobs of the image are queued
+// for deletion rather than deleted, since other images may share them.
+func (r *ItemImageDBRepository) DeleteImage(ctx context.Context, itemID int32, imageID int64) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		images, err := getItemImages(ctx, tx, itemID)
+		if err != nil {
+			return err
+		}
+		var deleted *domain.ItemImage
+		var rest []domain.ItemImage
+		for i := range images {
+			if images[i].ID == imageID {
+				deleted = &images[i]
+			} else {
+				rest = append(rest, images[i])
+			}
+		}
+		if deleted == nil {
+			return ErrImageNotFound
+		}
+		if len(rest) == 0 {
+			return ErrLastImage
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM item_images WHERE id = ?", imageID); err != nil {
+			return err
+		}
+		for _, key := range []string{deleted.ImageKey, deleted.ThumbnailKey, deleted.MediumKey} {
+			if err := queueImageKey(ctx, tx, key); err != nil {
+				return err
+			}
+		}
+		if deleted.IsCover {
+			if _, err := tx.ExecContext(ctx, "UPDATE item_images SET is_cover = 1 WHERE id = ?", rest[0].ID); err != nil {
+				return err
+			}
+		}
+		return touchItem(ctx, tx, itemID)
+	})
+}
+
+func (r *ItemImageDBRepository) SetRenditions(ctx context.Context, imageID int64, thumbnailKey, mediumKey string) error {
+	rst, err := r.ExecContext(ctx, "UPDATE item_images SET thumbnail_key = ?, medium_key = ? WHERE id = ?", thumbnailKey, mediumKey, imageID)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(rst, ErrImageNotFound)
+}
+
+// IsImageKeyUsed reports whether any image or rendition still refers to key.
+func (r *ItemImageDBRepository) IsImageKeyUsed(ctx context.Context, key string) (bool, error) {
+	var count int64
+	err := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM item_images WHERE image_key = ? OR thumbnail_key = ? OR medium_key = ?", key, key, key).Scan(&count)
+	return count > 0, err
+}
+
+// queueImageKey queues the blob of key for deletion, or restarts its wait
+// when it is already queued.
+func queueImageKey(ctx context.Context, tx *Tx, key string) error {
+	if key == "" {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM image_deletions WHERE image_key = ?", key); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO image_deletions (image_key, created_at) VALUES (?, ?)", key, now())
+	return err
+}
+
+func (r *ItemImageDBRepository) ClaimImageKeys(ctx context.Context, keys []string) error {
+	return claimImageKeys(ctx, r.DB, keys)
+}
+
+func claimImageKeys(ctx context.Context, q queryer, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	_, err := q.ExecContext(ctx, "DELETE FROM image_deletions WHERE image_key IN ("+placeholders(len(keys))+")", args...)
+	return err
+}
+
+func (r *ItemImageDBRepository) GetDeletedImageKeys(ctx context.Context, deletedBefore string) ([]string, error) {
+	rows, err := r.QueryContext(ctx, "SELECT image_key FROM image_deletions WHERE created_at <= ? ORDER BY created_at, image_key", deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *ItemImageDBRepository) SweepImageKey(ctx context.Context, store blobstore.Store, key, deletedBefore string) (bool, error) {
+	deleted := false
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		// uploads of the same blob claim the key and wait here until the
+		// blob is deleted, and then store it again
+		rst, err := tx.ExecContext(ctx, "DELETE FROM image_deletions WHERE image_key = ? AND created_at <= ?", key, deletedBefore)
+		if err != nil {
+			return err
+		}
+		if n, err := rst.RowsAffected(); err != nil || n == 0 {
+			// claimed, queued again or swept in the meantime
+			return err
+		}
+		var count int64
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM item_images WHERE image_key = ? OR thumbnail_key = ? OR medium_key = ?", key, key, key).Scan(&count)
+		if err != nil || count > 0 {
+			return err
+		}
+		if err := store.Delete(ctx, key); err != nil && err != blobstore.ErrNotFound {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	return deleted, err
+}
+
+// MoveItemImages moves images still stored in the legacy items.image column,
+// e.g. rows loaded from seed data, into store. It returns the number of
+// images moved.
+func MoveItemImages(ctx context.Context, db *DB, store blobstore.Store) (int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id FROM items WHERE image IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+	var ids []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		var image []byte
+		if err := db.QueryRowContext(ctx, "SELECT image FROM items WHERE id = ?", id).Scan(&image); err != nil {
+			return i, err
+		}
+		if err := claimImageKeys(ctx, db, []string{blobstore.Key(image)}); err != nil {
+			return i, err
+		}
+		key, err := store.Put(ctx, image)
+		if err != nil {
+			return i, err
+		}
+		err = withTx(ctx, db, func(tx *Tx) error {
+			if _, err := addItemImages(ctx, tx, id, []domain.ItemImage{{ImageKey: key}}); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "UPDATE items SET image = NULL WHERE id = ?", id)
+			return err
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
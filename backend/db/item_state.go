@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// moveItem changes the status of an item to the status to on behalf of the
+// actor, and records the change in the history of the item. userID is the
+// user acting, or 0 for the server. It returns errInvalid when the item can
+// not move from its current status to to, or when the actor is not allowed
+// to move it there.
+func moveItem(ctx context.Context, tx *Tx, itemID int32, to domain.ItemStatus, actor domain.ItemActor, userID int64, errInvalid error) error {
+	return changeItemStatus(ctx, tx, itemID, to, actor, userID, domain.CanMoveItem, errInvalid)
+}
+
+// returnItem moves a sold item whose order is cancelled to the status to,
+// like moveItem but through domain.ReturnedItemTransitions.
+func returnItem(ctx context.Context, tx *Tx, itemID int32, to domain.ItemStatus, actor domain.ItemActor, userID int64, errInvalid error) error {
+	return changeItemStatus(ctx, tx, itemID, to, actor, userID, domain.CanReturnItem, errInvalid)
+}
+
+func changeItemStatus(ctx context.Context, tx *Tx, itemID int32, to domain.ItemStatus, actor domain.ItemActor, userID int64, can func(from, to domain.ItemStatus, actor domain.ItemActor) bool, errInvalid error) error {
+	var from domain.ItemStatus
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM items WHERE id = ?", itemID).Scan(&from); err != nil {
+		return err
+	}
+	if !can(from, to, actor) {
+		return errInvalid
+	}
+
+	// 他の操作と競合したときはここで弾かれる
+	rst, err := tx.ExecContext(ctx, "UPDATE items SET status = ?, updated_at = ? WHERE id = ? AND status = ?", to, now(), itemID, from)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(rst, errInvalid); err != nil {
+		return err
+	}
+	return addItemStatusChange(ctx, tx, domain.ItemStatusChange{ItemID: itemID, From: from, To: to, Actor: actor, UserID: userID})
+}
+
+func addItemStatusChange(ctx context.Context, tx *Tx, change domain.ItemStatusChange) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO item_status_history (item_id, from_status, to_status, actor, user_id) VALUES (?, ?, ?, ?, ?)",
+		change.ItemID, nullInt64(int64(change.From)), change.To, change.Actor, nullInt64(change.UserID))
+	return err
+}
+
+func (r *ItemDBRepository) MoveItem(ctx context.Context, id int32, from, to domain.ItemStatus, actor domain.ItemActor, userID int64) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		if err := lockItem(ctx, tx, id); err != nil {
+			return err
+		}
+		return moveItemFrom(ctx, tx, id, from, to, actor, userID, ErrInvalidItemStatus)
+	})
+}
+
+// moveItemFrom is moveItem for an item locked by lockItem, which must be in
+// the status from.
+func moveItemFrom(ctx context.Context, tx *Tx, itemID int32, from, to domain.ItemStatus, actor domain.ItemActor, userID int64, errInvalid error) error {
+	var status domain.ItemStatus
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM items WHERE id = ?", itemID).Scan(&status); err != nil {
+		return err
+	}
+	if status != from {
+		return errInvalid
+	}
+	return moveItem(ctx, tx, itemID, to, actor, userID, errInvalid)
+}
+
+func (r *ItemDBRepository) WithdrawItem(ctx context.Context, id int32, to domain.ItemStatus, sellerID int64) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		if err := checkNotAuctioned(ctx, tx, id); err != nil {
+			return err
+		}
+		if err := moveItem(ctx, tx, id, to, domain.ItemActorSeller, sellerID, ErrInvalidItemStatus); err != nil {
+			return err
+		}
+		// a paused item can still be bought once it is resumed
+		if to == domain.ItemStatusPaused {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE offers SET status = ?, updated_at = ? WHERE item_id = ? AND status IN (?, ?)",
+			domain.OfferStatusRejected, now(), id, domain.OfferStatusPending, domain.OfferStatusCountered)
+		return err
+	})
+}
+
+func (r *ItemDBRepository) GetItemHistory(ctx context.Context, id int32) ([]domain.ItemStatusChange, error) {
+	rows, err := r.QueryContext(ctx, "SELECT id, item_id, from_status, to_status, actor, user_id, created_at FROM item_status_history WHERE item_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]domain.ItemStatusChange, 0)
+	for rows.Next() {
+		var change domain.ItemStatusChange
+		var from, userID sql.NullInt64
+		if err := rows.Scan(&change.ID, &change.ItemID, &from, &change.To, &change.Actor, &userID, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		change.From, change.UserID = domain.ItemStatus(from.Int64), userID.Int64
+		history = append(history, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// lockItem locks the row of the item until the end of tx, so that checks on
+// the item that read other tables are not raced by concurrent transactions.
+func lockItem(ctx context.Context, tx *Tx, itemID int32) error {
+	rst, err := tx.ExecContext(ctx, "UPDATE items SET status = status WHERE id = ?", itemID)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(rst, sql.ErrNoRows)
+}
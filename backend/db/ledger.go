@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+type LedgerRepository interface {
+	GetEntries(ctx context.Context, userID int64, limit, offset int) ([]domain.LedgerEntry, error)
+	CountEntries(ctx context.Context, userID int64) (int64, error)
+	GetLedgerBalance(ctx context.Context, userID int64) (int64, error)
+	GetMismatches(ctx context.Context) ([]domain.BalanceMismatch, error)
+}
+
+type LedgerDBRepository struct {
+	*DB
+}
+
+func NewLedgerRepository(db *DB) LedgerRepository {
+	return &LedgerDBRepository{DB: db}
+}
+
+func (r *LedgerDBRepository) GetEntries(ctx context.Context, userID int64, limit, offset int) ([]domain.LedgerEntry, error) {
+	rows, err := r.QueryContext(ctx, "SELECT id, user_id, type, amount, counterparty_id, item_id, created_at FROM ledger WHERE user_id = ? ORDER BY id DESC LIMIT ? OFFSET ?", userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]domain.LedgerEntry, 0)
+	for rows.Next() {
+		var entry domain.LedgerEntry
+		var counterpartyID, itemID sql.NullInt64
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Type, &entry.Amount, &counterpartyID, &itemID, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.CounterpartyID = counterpartyID.Int64
+		entry.ItemID = int32(itemID.Int64)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *LedgerDBRepository) CountEntries(ctx context.Context, userID int64) (int64, error) {
+	row := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM ledger WHERE user_id = ?", userID)
+
+	var count int64
+	return count, row.Scan(&count)
+}
+
+func (r *LedgerDBRepository) GetLedgerBalance(ctx context.Context, userID int64) (int64, error) {
+	row := r.QueryRowContext(ctx, "SELECT COALESCE(SUM(amount), 0) FROM ledger WHERE user_id = ?", userID)
+
+	var balance int64
+	return balance, row.Scan(&balance)
+}
+
+func (r *LedgerDBRepository) GetMismatches(ctx context.Context) ([]domain.BalanceMismatch, error) {
+	rows, err := r.QueryContext(ctx, `
+		SELECT users.id, users.balance, COALESCE(SUM(ledger.amount), 0) AS ledger_balance
+		FROM users
+		LEFT OUTER JOIN ledger
+		ON users.id = ledger.user_id
+		GROUP BY users.id, users.balance
+		HAVING users.balance != COALESCE(SUM(ledger.amount), 0)
+		`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mismatches []domain.BalanceMismatch
+	for rows.Next() {
+		var m domain.BalanceMismatch
+		if err := rows.Scan(&m.UserID, &m.Balance, &m.LedgerBalance); err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return mismatches, nil
+}
+
+// BackfillOpeningBalances records the current balance of users who have no
+// ledger entries yet, e.g. users loaded from seed data, so that every balance
+// can be derived from the ledger.
+func BackfillOpeningBalances(ctx context.Context, db *DB) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO ledger (user_id, type, amount)
+		SELECT id, ?, balance FROM users
+		WHERE balance != 0 AND NOT EXISTS (SELECT 1 FROM ledger WHERE ledger.user_id = users.id)
+		`, domain.LedgerTypeOpening)
+	return err
+}
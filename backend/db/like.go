@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+type LikeRepository interface {
+	// AddLike and RemoveLike do nothing when the user already likes or does
+	// not like the item.
+	AddLike(ctx context.Context, userID int64, itemID int32) error
+	RemoveLike(ctx context.Context, userID int64, itemID int32) error
+	CountLikes(ctx context.Context, itemID int32) (int64, error)
+	// GetLikedItems lists the items the user likes, leaving out deleted ones.
+	GetLikedItems(ctx context.Context, userID int64, opts ItemListOptions) (ItemPage, error)
+	// GetWatchers returns the users who like the item.
+	GetWatchers(ctx context.Context, itemID int32) ([]int64, error)
+}
+
+type LikeDBRepository struct {
+	*DB
+}
+
+func NewLikeRepository(db *DB) LikeRepository {
+	return &LikeDBRepository{DB: db}
+}
+
+func (r *LikeDBRepository) AddLike(ctx context.Context, userID int64, itemID int32) error {
+	_, err := r.ExecContext(ctx, "INSERT INTO likes (user_id, item_id) VALUES (?, ?)", userID, itemID)
+	if isUniqueViolation(err) {
+		// liked already, maybe by a concurrent request
+		return nil
+	}
+	return err
+}
+
+func (r *LikeDBRepository) RemoveLike(ctx context.Context, userID int64, itemID int32) error {
+	_, err := r.ExecContext(ctx, "DELETE FROM likes WHERE user_id = ? AND item_id = ?", userID, itemID)
+	return err
+}
+
+func (r *LikeDBRepository) CountLikes(ctx context.Context, itemID int32) (int64, error) {
+	row := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM likes WHERE item_id = ?", itemID)
+
+	var count int64
+	return count, row.Scan(&count)
+}
+
+func (r *LikeDBRepository) GetLikedItems(ctx context.Context, userID int64, opts ItemListOptions) (ItemPage, error) {
+	return listItems(ctx, r.DB, itemQuery{
+		from:  itemsWithCat + " JOIN likes ON likes.item_id = items.id",
+		where: "likes.user_id = ? AND items.status <> ?",
+		args:  []any{userID, domain.ItemStatusDeleted},
+	}, opts)
+}
+
+func (r *LikeDBRepository) GetWatchers(ctx context.Context, itemID int32) ([]int64, error) {
+	rows, err := r.QueryContext(ctx, "SELECT user_id FROM likes WHERE item_id = ? ORDER BY user_id", itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// likeCount selects the number of likes of each item of a listing.
+const likeCount = "(SELECT COUNT(*) FROM likes WHERE likes.item_id = items.id)"
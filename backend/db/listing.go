@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+var (
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrUnsupportedSort = errors.New("sort is not supported by this listing")
+)
+
+// ItemCursor points at the last item of a page. Value is the sort key of that
+// item, formatted as a string, or the offset of the next page for the
+// relevance sort.
+type ItemCursor struct {
+	Sort  domain.ItemSort `json:"s"`
+	Value string          `json:"v"`
+	ID    int32           `json:"i"`
+}
+
+type ItemListOptions struct {
+	Sort  domain.ItemSort
+	Limit int
+	// After continues the listing after this cursor when it is not nil.
+	After *ItemCursor
+}
+
+type ItemPage struct {
+	Items []domain.ItemWithCategory
+	// Total is the number of items matching the listing regardless of the
+	// page.
+	Total int64
+	// Next is nil on the last page.
+	Next *ItemCursor
+}
+
+type itemSort struct {
+	column string
+	desc   bool
+}
+
+// Items are ordered by id after the sort column, so that every item has a
+// unique position to continue from.
+var itemSorts = map[domain.ItemSort]itemSort{
+	domain.ItemSortNewest:    {"items.created_at", true},
+	domain.ItemSortPriceAsc:  {"items.price", false},
+	domain.ItemSortPriceDesc: {"items.price", true},
+	domain.ItemSortUpdated:   {"items.updated_at", true},
+}
+
+func (s itemSort) value(item domain.Item) string {
+	switch s.column {
+	case "items.price":
+		return strconv.FormatInt(item.Price, 10)
+	case "items.created_at":
+		return item.CreatedAt
+	}
+	return item.UpdatedAt
+}
+
+// itemQuery selects the items of a listing.
+type itemQuery struct {
+	// from joins items and category, and defaults to itemsWithCat.
+	from string
+	// where may only refer to items, category and the tables in from.
+	where string
+	args  []any
+	// rank orders the relevance sort, best first. The relevance sort is not
+	// supported when it is empty.
+	rank     string
+	rankArgs []any
+}
+
+// listItems returns a page of the items matching q.
+func listItems(ctx context.Context, db queryer, q itemQuery, opts ItemListOptions) (ItemPage, error) {
+	if q.from == "" {
+		q.from = itemsWithCat
+	}
+	if opts.After != nil && opts.After.Sort != opts.Sort {
+		return ItemPage{}, ErrInvalidCursor
+	}
+
+	var page ItemPage
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+q.from+" WHERE "+q.where, q.args...).Scan(&page.Total); err != nil {
+		return ItemPage{}, err
+	}
+
+	query := "SELECT " + itemWithCatColumns + ", " + likeCount + " FROM " + q.from + " WHERE (" + q.where + ")"
+	args := append([]any{}, q.args...)
+
+	// the relevance sort has no column to continue from, so its cursor is an
+	// offset
+	offset := 0
+	var sort itemSort
+	if opts.Sort == domain.ItemSortRelevance {
+		if q.rank == "" {
+			return ItemPage{}, ErrUnsupportedSort
+		}
+		if opts.After != nil {
+			n, err := strconv.Atoi(opts.After.Value)
+			if err != nil || n < 0 {
+				return ItemPage{}, ErrInvalidCursor
+			}
+			offset = n
+		}
+		query += " ORDER BY " + q.rank + ", items.id DESC LIMIT ? OFFSET ?"
+		args = append(args, q.rankArgs...)
+		// read one more item to know whether there is a next page
+		args = append(args, opts.Limit+1, offset)
+	} else {
+		var ok bool
+		sort, ok = itemSorts[opts.Sort]
+		if !ok {
+			return ItemPage{}, ErrUnsupportedSort
+		}
+		if opts.After != nil {
+			var value any = opts.After.Value
+			if sort.column == "items.price" {
+				price, err := strconv.ParseInt(opts.After.Value, 10, 64)
+				if err != nil {
+					return ItemPage{}, ErrInvalidCursor
+				}
+				value = price
+			}
+			op := ">"
+			if sort.desc {
+				op = "<"
+			}
+			query += fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND items.id %[2]s ?))", sort.column, op)
+			args = append(args, value, value, opts.After.ID)
+		}
+		dir := "ASC"
+		if sort.desc {
+			dir = "DESC"
+		}
+		query += fmt.Sprintf(" ORDER BY %s %s, items.id %s LIMIT ?", sort.column, dir, dir)
+		args = append(args, opts.Limit+1)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return ItemPage{}, err
+	}
+	defer rows.Close()
+
+	page.Items = make([]domain.ItemWithCategory, 0, opts.Limit)
+	for rows.Next() {
+		var item domain.Item
+		// the category is NULL when it does not exist
+		var categoryID sql.NullInt64
+		var categoryName sql.NullString
+		var likes int64
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.BuyerID, &item.Status, &item.CreatedAt, &item.UpdatedAt, &categoryID, &categoryName, &likes); err != nil {
+			return ItemPage{}, err
+		}
+		category := domain.Category{ID: categoryID.Int64, Name: categoryName.String}
+		page.Items = append(page.Items, domain.ItemWithCategory{Item: item, Category: category, LikeCount: likes})
+	}
+	if err := rows.Err(); err != nil {
+		return ItemPage{}, err
+	}
+
+	if len(page.Items) > opts.Limit {
+		page.Items = page.Items[:opts.Limit]
+		last := page.Items[len(page.Items)-1].Item
+		page.Next = &ItemCursor{Sort: opts.Sort, ID: last.ID}
+		if opts.Sort == domain.ItemSortRelevance {
+			page.Next.Value = strconv.Itoa(offset + opts.Limit)
+		} else {
+			page.Next.Value = sort.value(last)
+		}
+	}
+	return page, nil
+}
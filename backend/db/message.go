@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// MessageRepository stores the public comments of each item and the private
+// thread of each order. orderID selects the private thread of that order in
+// every method, or the public comments of the item when it is 0.
+type MessageRepository interface {
+	// AddMessage adds a private message when message.OrderID is set.
+	AddMessage(ctx context.Context, message domain.Message) (int64, error)
+	// GetMessages lists the messages of a thread, oldest first.
+	GetMessages(ctx context.Context, itemID int32, orderID int64, limit, offset int) ([]domain.Message, error)
+	CountMessages(ctx context.Context, itemID int32, orderID int64) (int64, error)
+	// MarkMessagesRead marks the messages of a thread to the recipient as
+	// read.
+	MarkMessagesRead(ctx context.Context, itemID int32, orderID int64, recipientID int64) error
+}
+
+type MessageDBRepository struct {
+	*DB
+}
+
+func NewMessageRepository(db *DB) MessageRepository {
+	return &MessageDBRepository{DB: db}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// threadFilter returns the WHERE clause of the messages of a thread.
+func threadFilter(itemID int32, orderID int64) (string, []any) {
+	if orderID == 0 {
+		return "messages.item_id = ? AND messages.is_private = 0", []any{itemID}
+	}
+	return "messages.item_id = ? AND messages.is_private = 1 AND messages.order_id = ?", []any{itemID, orderID}
+}
+
+func (r *MessageDBRepository) AddMessage(ctx context.Context, message domain.Message) (int64, error) {
+	return insertID(ctx, r.DB, r.Dialect, "INSERT INTO messages (item_id, order_id, sender_id, recipient_id, is_private, body) VALUES (?, ?, ?, ?, ?, ?)",
+		message.ItemID, nullInt64(message.OrderID), message.SenderID, nullInt64(message.RecipientID), boolInt(message.OrderID != 0), message.Body)
+}
+
+func (r *MessageDBRepository) GetMessages(ctx context.Context, itemID int32, orderID int64, limit, offset int) ([]domain.Message, error) {
+	where, args := threadFilter(itemID, orderID)
+	rows, err := r.QueryContext(ctx, `
+		SELECT messages.id, messages.item_id, COALESCE(messages.order_id, 0), messages.sender_id, users.name, messages.recipient_id,
+			messages.is_private, messages.body, messages.is_read, messages.created_at
+		FROM messages JOIN users ON users.id = messages.sender_id
+		WHERE `+where+`
+		ORDER BY messages.id LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]domain.Message, 0)
+	for rows.Next() {
+		var m domain.Message
+		var recipientID sql.NullInt64
+		var isPrivate, isRead int
+		if err := rows.Scan(&m.ID, &m.ItemID, &m.OrderID, &m.SenderID, &m.SenderName, &recipientID, &isPrivate, &m.Body, &isRead, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.RecipientID = recipientID.Int64
+		m.Private = isPrivate != 0
+		m.IsRead = isRead != 0
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *MessageDBRepository) CountMessages(ctx context.Context, itemID int32, orderID int64) (int64, error) {
+	where, args := threadFilter(itemID, orderID)
+	row := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM messages WHERE "+where, args...)
+
+	var count int64
+	return count, row.Scan(&count)
+}
+
+func (r *MessageDBRepository) MarkMessagesRead(ctx context.Context, itemID int32, orderID int64, recipientID int64) error {
+	where, args := threadFilter(itemID, orderID)
+	_, err := r.ExecContext(ctx, "UPDATE messages SET is_read = 1 WHERE "+where+" AND messages.recipient_id = ?", append(args, recipientID)...)
+	return err
+}
@@ -0,0 +1,262 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Migrations live in migrations/ as NNNN_name.up.sql and NNNN_name.down.sql.
+// A file may be overridden for one backend by NNNN_name.up.<dialect>.sql when
+// the Dialect macros are not enough, and a migration that only has such files
+// only exists for that backend. Never edit a migration that has been applied;
+// add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)(?:\.(\w+))?\.sql$`)
+
+var ErrMigrationModified = errors.New("applied migration has been modified")
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt string
+	Modified  bool
+}
+
+const createSchemaMigrations = `
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    integer primary key,
+    name       varchar(255) NOT NULL,
+    checksum   varchar(64) NOT NULL,
+    applied_at {{timestamp}}
+);`
+
+// LoadMigrations returns the embedded migrations for dialect d sorted by
+// version, with the macros already rendered.
+func LoadMigrations(d Dialect) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := migrationFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		if m[4] != "" && m[4] != d.migrations {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		b, err := migrationFS.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names: %s, %s", version, mig.Name, m[2])
+		}
+		// a dialect specific file wins over the generic one
+		sql := d.Render(string(b))
+		if m[3] == "up" && (mig.Up == "" || m[4] != "") {
+			mig.Up = sql
+		} else if m[3] == "down" && (mig.Down == "" || m[4] != "") {
+			mig.Down = sql
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", mig.Version, mig.Name)
+		}
+		mig.Checksum = MigrationChecksum(mig.Up, mig.Down)
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrationChecksum is the checksum recorded for a migration with the scripts
+// up and down. Each script is prefixed with its length, so that moving text
+// from one script to the other changes the checksum too.
+func MigrationChecksum(up, down string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%s%d:%s", len(up), up, len(down), down)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// upChecksum is the checksum recorded before the down script was part of it.
+func upChecksum(up string) string {
+	sum := sha256.Sum256([]byte(up))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetMigrationStatus reports every known migration and whether it has been
+// applied. Applied migrations whose file no longer matches the recorded
+// checksum are marked as modified.
+func GetMigrationStatus(ctx context.Context, db *DB) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, db.Dialect.Render(createSchemaMigrations)); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type applied struct {
+		checksum  string
+		appliedAt string
+	}
+	appliedVersions := map[int]applied{}
+	for rows.Next() {
+		var version int
+		var a applied
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		appliedVersions[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, mig := range migrations {
+		st := MigrationStatus{Migration: mig}
+		if a, ok := appliedVersions[mig.Version]; ok {
+			st.Applied = true
+			st.AppliedAt = a.appliedAt
+			if a.checksum == upChecksum(mig.Up) {
+				// recorded before the down script was checked, which is
+				// taken as it is now
+				_, err := db.ExecContext(ctx, "UPDATE schema_migrations SET checksum = ? WHERE version = ?", mig.Checksum, mig.Version)
+				if err != nil {
+					return nil, err
+				}
+				a.checksum = mig.Checksum
+			}
+			st.Modified = a.checksum != mig.Checksum
+			delete(appliedVersions, mig.Version)
+		}
+		statuses = append(statuses, st)
+	}
+	for version := range appliedVersions {
+		return nil, fmt.Errorf("migration %04d is applied but its files are missing", version)
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies all pending migrations in order, each in its own
+// transaction. It refuses to run if an applied migration has been modified.
+func MigrateUp(ctx context.Context, db *DB) ([]Migration, error) {
+	statuses, err := GetMigrationStatus(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	mdb, err := db.forMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mdb != db {
+		defer mdb.Close()
+	}
+	for _, st := range statuses {
+		if st.Modified {
+			return nil, errors.Wrapf(ErrMigrationModified, "%04d_%s", st.Version, st.Name)
+		}
+	}
+
+	var done []Migration
+	for _, st := range statuses {
+		if st.Applied {
+			continue
+		}
+		err := withTx(ctx, mdb, func(tx *Tx) error {
+			if _, err := tx.ExecContext(ctx, st.Up); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)", st.Version, st.Name, st.Checksum)
+			return err
+		})
+		if err != nil {
+			return done, errors.Wrapf(err, "failed to apply migration %04d_%s", st.Version, st.Name)
+		}
+		done = append(done, st.Migration)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the latest steps applied migrations. A negative steps
+// reverts all of them. It refuses to revert a migration that has been
+// modified since it was applied.
+func MigrateDown(ctx context.Context, db *DB, steps int) ([]Migration, error) {
+	statuses, err := GetMigrationStatus(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	mdb, err := db.forMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mdb != db {
+		defer mdb.Close()
+	}
+
+	var done []Migration
+	for i := len(statuses) - 1; i >= 0 && steps != 0; i-- {
+		st := statuses[i]
+		if !st.Applied {
+			continue
+		}
+		if st.Modified {
+			return done, errors.Wrapf(ErrMigrationModified, "%04d_%s", st.Version, st.Name)
+		}
+		err := withTx(ctx, mdb, func(tx *Tx) error {
+			if _, err := tx.ExecContext(ctx, st.Down); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", st.Version)
+			return err
+		})
+		if err != nil {
+			return done, errors.Wrapf(err, "failed to revert migration %04d_%s", st.Version, st.Name)
+		}
+		done = append(done, st.Migration)
+		steps--
+	}
+	return done, nil
+}
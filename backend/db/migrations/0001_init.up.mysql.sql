@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS category
+(
+    id   integer primary key,
+    name varchar(50)
+);
+
+CREATE TABLE IF NOT EXISTS items
+(
+    id          integer primary key auto_increment,
+    name        varchar(50),
+    price       integer,
+    description text,
+    category_id integer,
+    seller_id   integer,
+    image       mediumblob,
+    status      integer,
+    created_at  varchar(19) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s')),
+    updated_at  varchar(19) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s')),
+    FOREIGN KEY(category_id) REFERENCES category(id)
+);
+
+CREATE TABLE IF NOT EXISTS users
+(
+    id       integer primary key auto_increment,
+    name     varchar(50),
+    password varbinary(60),
+    balance  integer default 0
+);
+
+CREATE TABLE IF NOT EXISTS status
+(
+    id   integer primary key,
+    name varchar(50)
+);
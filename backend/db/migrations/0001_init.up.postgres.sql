@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS category
+(
+    id   integer primary key,
+    name varchar(50)
+);
+
+CREATE TABLE IF NOT EXISTS items
+(
+    id          serial primary key,
+    name        varchar(50),
+    price       integer,
+    description text,
+    category_id integer,
+    seller_id   integer,
+    image       bytea,
+    status      integer,
+    created_at  text NOT NULL DEFAULT (to_char(localtimestamp, 'YYYY-MM-DD HH24:MI:SS')),
+    updated_at  text NOT NULL DEFAULT (to_char(localtimestamp, 'YYYY-MM-DD HH24:MI:SS')),
+    FOREIGN KEY(category_id) REFERENCES category(id)
+);
+
+CREATE TABLE IF NOT EXISTS users
+(
+    id       serial primary key,
+    name     varchar(50),
+    password varchar(60),
+    balance  integer default 0
+);
+
+CREATE TABLE IF NOT EXISTS status
+(
+    id   integer primary key,
+    name varchar(50)
+);
@@ -31,4 +31,4 @@ CREATE TABLE IF NOT EXISTS status
 (
     id   integer primary key,
     name varchar(50)
-);
\ No newline at end of file
+);
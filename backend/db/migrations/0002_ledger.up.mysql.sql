@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS ledger
+(
+    id              integer primary key auto_increment,
+    user_id         integer NOT NULL,
+    type            varchar(20) NOT NULL,
+    amount          integer NOT NULL,
+    counterparty_id integer,
+    item_id         integer,
+    created_at      varchar(19) NOT NULL DEFAULT (DATE_FORMAT(NOW(), '%Y-%m-%d %H:%i:%s')),
+    INDEX ledger_user_id (user_id),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TRIGGER ledger_no_update BEFORE UPDATE ON ledger FOR EACH ROW
+BEGIN
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'ledger is append-only';
+END;
+
+CREATE TRIGGER ledger_no_delete BEFORE DELETE ON ledger FOR EACH ROW
+BEGIN
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'ledger is append-only';
+END;
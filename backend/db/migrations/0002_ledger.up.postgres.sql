@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS ledger
+(
+    id              serial primary key,
+    user_id         integer NOT NULL,
+    type            varchar(20) NOT NULL,
+    amount          integer NOT NULL,
+    counterparty_id integer,
+    item_id         integer,
+    created_at      text NOT NULL DEFAULT (to_char(localtimestamp, 'YYYY-MM-DD HH24:MI:SS')),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS ledger_user_id ON ledger (user_id);
+
+CREATE OR REPLACE FUNCTION ledger_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_no_update BEFORE UPDATE OR DELETE ON ledger
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS ledger
+(
+    id              integer primary key autoincrement,
+    user_id         integer NOT NULL,
+    type            varchar(20) NOT NULL,
+    amount          integer NOT NULL,
+    counterparty_id integer,
+    item_id         integer,
+    created_at      text NOT NULL DEFAULT (DATETIME('now', 'localtime')),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS ledger_user_id ON ledger (user_id);
+
+CREATE TRIGGER IF NOT EXISTS ledger_no_update BEFORE UPDATE ON ledger
+BEGIN
+    SELECT RAISE(ABORT, 'ledger is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS ledger_no_delete BEFORE DELETE ON ledger
+BEGIN
+    SELECT RAISE(ABORT, 'ledger is append-only');
+END;
@@ -0,0 +1 @@
+ALTER TABLE items ADD COLUMN image_key varchar(64);
@@ -0,0 +1,7 @@
+ALTER TABLE items ADD COLUMN image_key varchar(64);
+
+UPDATE items SET image_key = (
+    SELECT image_key FROM item_images WHERE item_images.item_id = items.id AND item_images.is_cover = 1
+);
+
+DROP TABLE item_images;
@@ -0,0 +1,17 @@
+CREATE TABLE item_images
+(
+    id         {{serial}},
+    item_id    integer NOT NULL,
+    image_key  varchar(64) NOT NULL,
+    position   integer NOT NULL,
+    is_cover   integer NOT NULL DEFAULT 0,
+    created_at {{timestamp}},
+    FOREIGN KEY(item_id) REFERENCES items(id)
+);
+
+CREATE INDEX item_images_item_id ON item_images (item_id);
+
+INSERT INTO item_images (item_id, image_key, position, is_cover)
+SELECT id, image_key, 0, 1 FROM items WHERE image_key IS NOT NULL;
+
+ALTER TABLE items DROP COLUMN image_key;
@@ -0,0 +1,2 @@
+ALTER TABLE item_images DROP COLUMN medium_key;
+ALTER TABLE item_images DROP COLUMN thumbnail_key;
@@ -0,0 +1,2 @@
+ALTER TABLE item_images ADD COLUMN thumbnail_key varchar(64);
+ALTER TABLE item_images ADD COLUMN medium_key varchar(64);
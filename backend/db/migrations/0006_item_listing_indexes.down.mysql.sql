@@ -0,0 +1,4 @@
+DROP INDEX items_seller_id ON items;
+DROP INDEX items_price ON items;
+DROP INDEX items_created_at ON items;
+DROP INDEX items_status_updated_at ON items;
@@ -0,0 +1,4 @@
+DROP INDEX items_seller_id;
+DROP INDEX items_price;
+DROP INDEX items_created_at;
+DROP INDEX items_status_updated_at;
@@ -0,0 +1,4 @@
+CREATE INDEX items_status_updated_at ON items (status, updated_at);
+CREATE INDEX items_created_at ON items (created_at);
+CREATE INDEX items_price ON items (price);
+CREATE INDEX items_seller_id ON items (seller_id);
@@ -0,0 +1,33 @@
+DROP TRIGGER items_fts_delete;
+DROP TRIGGER items_fts_insert;
+DROP TABLE items_fts;
+DROP TABLE item_search;
+
+CREATE VIRTUAL TABLE items_fts USING fts5(
+    name,
+    description,
+    category,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO items_fts (rowid, name, description, category)
+SELECT items.id, items.name, items.description, COALESCE(category.name, '')
+FROM items LEFT OUTER JOIN category ON items.category_id = category.id;
+
+CREATE TRIGGER items_fts_insert AFTER INSERT ON items
+BEGIN
+    INSERT INTO items_fts (rowid, name, description, category)
+    VALUES (new.id, new.name, new.description, COALESCE((SELECT name FROM category WHERE id = new.category_id), ''));
+END;
+
+CREATE TRIGGER items_fts_update AFTER UPDATE OF name, description, category_id ON items
+BEGIN
+    DELETE FROM items_fts WHERE rowid = old.id;
+    INSERT INTO items_fts (rowid, name, description, category)
+    VALUES (new.id, new.name, new.description, COALESCE((SELECT name FROM category WHERE id = new.category_id), ''));
+END;
+
+CREATE TRIGGER items_fts_delete AFTER DELETE ON items
+BEGIN
+    DELETE FROM items_fts WHERE rowid = old.id;
+END;
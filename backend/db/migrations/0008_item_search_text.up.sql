@@ -0,0 +1,10 @@
+-- Normalized and tokenized text of items, written by the server because the
+-- normalization is done in Go. See package textsearch.
+CREATE TABLE item_search
+(
+    item_id     integer NOT NULL PRIMARY KEY,
+    name        text NOT NULL,
+    description text NOT NULL,
+    category    text NOT NULL,
+    FOREIGN KEY(item_id) REFERENCES items(id)
+);
@@ -0,0 +1,35 @@
+-- Normalized and tokenized text of items, written by the server because the
+-- normalization is done in Go. See package textsearch.
+CREATE TABLE item_search
+(
+    item_id     integer NOT NULL PRIMARY KEY,
+    name        text NOT NULL,
+    description text NOT NULL,
+    category    text NOT NULL,
+    FOREIGN KEY(item_id) REFERENCES items(id)
+);
+
+-- items_fts now indexes item_search instead of items. It is empty until the
+-- server indexes the items on start.
+DROP TRIGGER items_fts_delete;
+DROP TRIGGER items_fts_update;
+DROP TRIGGER items_fts_insert;
+DROP TABLE items_fts;
+
+CREATE VIRTUAL TABLE items_fts USING fts5(
+    name,
+    description,
+    category,
+    tokenize = 'unicode61 remove_diacritics 0'
+);
+
+CREATE TRIGGER items_fts_insert AFTER INSERT ON item_search
+BEGIN
+    INSERT INTO items_fts (rowid, name, description, category)
+    VALUES (new.item_id, new.name, new.description, new.category);
+END;
+
+CREATE TRIGGER items_fts_delete AFTER DELETE ON item_search
+BEGIN
+    DELETE FROM items_fts WHERE rowid = old.item_id;
+END;
@@ -0,0 +1,31 @@
+-- category_ids is a comma separated list of category ids, '' for any
+CREATE TABLE saved_searches
+(
+    id           {{serial}},
+    user_id      integer NOT NULL,
+    query        varchar(255) NOT NULL,
+    category_ids varchar(255) NOT NULL DEFAULT '',
+    min_price    integer NOT NULL DEFAULT 0,
+    max_price    integer NOT NULL DEFAULT 0,
+    seller_id    integer NOT NULL DEFAULT 0,
+    created_at   {{timestamp}},
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX saved_searches_user_id ON saved_searches (user_id);
+
+-- saved_search_id has no foreign key, notifications outlive deleted searches
+CREATE TABLE notifications
+(
+    id              {{serial}},
+    user_id         integer NOT NULL,
+    type            varchar(20) NOT NULL,
+    item_id         integer NOT NULL,
+    saved_search_id integer,
+    is_read         integer NOT NULL DEFAULT 0,
+    created_at      {{timestamp}},
+    FOREIGN KEY(user_id) REFERENCES users(id),
+    FOREIGN KEY(item_id) REFERENCES items(id)
+);
+
+CREATE INDEX notifications_user_id ON notifications (user_id, is_read);
@@ -0,0 +1,11 @@
+CREATE TABLE likes
+(
+    user_id    integer NOT NULL,
+    item_id    integer NOT NULL,
+    created_at {{timestamp}},
+    PRIMARY KEY (user_id, item_id),
+    FOREIGN KEY(user_id) REFERENCES users(id),
+    FOREIGN KEY(item_id) REFERENCES items(id)
+);
+
+CREATE INDEX likes_item_id ON likes (item_id);
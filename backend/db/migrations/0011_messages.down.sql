@@ -0,0 +1,3 @@
+DROP TABLE messages;
+
+ALTER TABLE items DROP COLUMN buyer_id;
@@ -0,0 +1,24 @@
+ALTER TABLE items ADD COLUMN buyer_id integer;
+
+UPDATE items SET buyer_id = (
+    SELECT user_id FROM ledger WHERE ledger.item_id = items.id AND ledger.type = 'purchase' ORDER BY ledger.id DESC LIMIT 1
+);
+
+-- recipient_id is the user who has to read the message: the seller for
+-- public comments of others, the other party in a private thread, and NULL
+-- for the answers of the seller to public comments
+CREATE TABLE messages
+(
+    id           {{serial}},
+    item_id      integer NOT NULL,
+    sender_id    integer NOT NULL,
+    recipient_id integer,
+    is_private   integer NOT NULL DEFAULT 0,
+    body         text NOT NULL,
+    is_read      integer NOT NULL DEFAULT 0,
+    created_at   {{timestamp}},
+    FOREIGN KEY(item_id) REFERENCES items(id),
+    FOREIGN KEY(sender_id) REFERENCES users(id)
+);
+
+CREATE INDEX messages_item_id ON messages (item_id, is_private);
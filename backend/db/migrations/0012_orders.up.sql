@@ -0,0 +1,23 @@
+CREATE TABLE orders
+(
+    id         {{serial}},
+    item_id    integer NOT NULL,
+    buyer_id   integer NOT NULL,
+    seller_id  integer NOT NULL,
+    price      integer NOT NULL,
+    status     varchar(20) NOT NULL,
+    created_at {{timestamp}},
+    updated_at {{timestamp}},
+    FOREIGN KEY(item_id) REFERENCES items(id),
+    FOREIGN KEY(buyer_id) REFERENCES users(id),
+    FOREIGN KEY(seller_id) REFERENCES users(id)
+);
+
+CREATE INDEX orders_item_id ON orders (item_id);
+CREATE INDEX orders_buyer_id ON orders (buyer_id);
+CREATE INDEX orders_seller_id ON orders (seller_id);
+
+-- purchases made before orders paid the seller at once, so they are completed
+INSERT INTO orders (item_id, buyer_id, seller_id, price, status, created_at, updated_at)
+SELECT item_id, user_id, counterparty_id, -amount, 'completed', created_at, created_at
+FROM ledger WHERE type = 'purchase';
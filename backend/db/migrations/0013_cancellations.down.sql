@@ -0,0 +1,3 @@
+DROP TABLE admins;
+
+DROP TABLE cancellations;
@@ -0,0 +1,21 @@
+CREATE TABLE cancellations
+(
+    id           {{serial}},
+    order_id     integer NOT NULL,
+    requested_by integer NOT NULL,
+    reason       varchar(255) NOT NULL DEFAULT '',
+    status       varchar(20) NOT NULL,
+    created_at   {{timestamp}},
+    updated_at   {{timestamp}},
+    FOREIGN KEY(order_id) REFERENCES orders(id),
+    FOREIGN KEY(requested_by) REFERENCES users(id)
+);
+
+CREATE INDEX cancellations_order_id ON cancellations (order_id, status);
+
+-- admins can force refunds; add them with INSERT INTO admins (user_id) VALUES (...)
+CREATE TABLE admins
+(
+    user_id integer primary key,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
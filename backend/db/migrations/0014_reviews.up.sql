@@ -0,0 +1,16 @@
+CREATE TABLE reviews
+(
+    id          {{serial}},
+    order_id    integer NOT NULL,
+    reviewer_id integer NOT NULL,
+    reviewee_id integer NOT NULL,
+    rating      varchar(10) NOT NULL,
+    comment     text NOT NULL,
+    created_at  {{timestamp}},
+    FOREIGN KEY(order_id) REFERENCES orders(id),
+    FOREIGN KEY(reviewer_id) REFERENCES users(id),
+    FOREIGN KEY(reviewee_id) REFERENCES users(id)
+);
+
+CREATE UNIQUE INDEX reviews_order_id ON reviews (order_id, reviewer_id);
+CREATE INDEX reviews_reviewee_id ON reviews (reviewee_id);
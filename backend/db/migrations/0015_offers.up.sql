@@ -0,0 +1,20 @@
+-- expires_at is set when the offer is accepted
+CREATE TABLE offers
+(
+    id         {{serial}},
+    item_id    integer NOT NULL,
+    buyer_id   integer NOT NULL,
+    seller_id  integer NOT NULL,
+    price      integer NOT NULL,
+    status     varchar(20) NOT NULL,
+    expires_at varchar(19),
+    created_at {{timestamp}},
+    updated_at {{timestamp}},
+    FOREIGN KEY(item_id) REFERENCES items(id),
+    FOREIGN KEY(buyer_id) REFERENCES users(id),
+    FOREIGN KEY(seller_id) REFERENCES users(id)
+);
+
+CREATE INDEX offers_item_id ON offers (item_id, status);
+CREATE INDEX offers_buyer_id ON offers (buyer_id);
+CREATE INDEX offers_seller_id ON offers (seller_id);
@@ -0,0 +1,3 @@
+UPDATE items SET status = 2 WHERE status = 4;
+
+DROP TABLE reservations;
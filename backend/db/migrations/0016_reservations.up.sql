@@ -0,0 +1,29 @@
+-- offer_id is set when the reservation comes from an accepted offer
+CREATE TABLE reservations
+(
+    id         {{serial}},
+    item_id    integer NOT NULL,
+    buyer_id   integer NOT NULL,
+    price      integer NOT NULL,
+    offer_id   integer,
+    status     varchar(20) NOT NULL,
+    expires_at varchar(19) NOT NULL,
+    created_at {{timestamp}},
+    updated_at {{timestamp}},
+    FOREIGN KEY(item_id) REFERENCES items(id),
+    FOREIGN KEY(buyer_id) REFERENCES users(id),
+    FOREIGN KEY(offer_id) REFERENCES offers(id)
+);
+
+CREATE INDEX reservations_item_id ON reservations (item_id, status);
+CREATE INDEX reservations_expires_at ON reservations (status, expires_at);
+
+-- accepted offers used to reserve their items by themselves; expired ones
+-- are released by the sweeper
+INSERT INTO reservations (item_id, buyer_id, price, offer_id, status, expires_at)
+SELECT offers.item_id, offers.buyer_id, offers.price, offers.id, 'active', offers.expires_at
+FROM offers JOIN items ON items.id = offers.item_id
+WHERE offers.status = 'accepted' AND items.status = 2;
+
+UPDATE items SET status = 4
+WHERE status = 2 AND id IN (SELECT item_id FROM reservations WHERE status = 'active');
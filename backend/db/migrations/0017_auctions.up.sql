@@ -0,0 +1,33 @@
+-- an item has at most one open auction
+CREATE TABLE auctions
+(
+    id            {{serial}},
+    item_id       integer NOT NULL,
+    seller_id     integer NOT NULL,
+    start_price   integer NOT NULL,
+    min_increment integer NOT NULL,
+    ends_at       varchar(19) NOT NULL,
+    status        varchar(20) NOT NULL,
+    created_at    {{timestamp}},
+    updated_at    {{timestamp}},
+    FOREIGN KEY(item_id) REFERENCES items(id),
+    FOREIGN KEY(seller_id) REFERENCES users(id)
+);
+
+CREATE INDEX auctions_item_id ON auctions (item_id, status);
+CREATE INDEX auctions_ends_at ON auctions (status, ends_at);
+
+CREATE TABLE bids
+(
+    id         {{serial}},
+    auction_id integer NOT NULL,
+    bidder_id  integer NOT NULL,
+    amount     integer NOT NULL,
+    status     varchar(20) NOT NULL,
+    created_at {{timestamp}},
+    updated_at {{timestamp}},
+    FOREIGN KEY(auction_id) REFERENCES auctions(id),
+    FOREIGN KEY(bidder_id) REFERENCES users(id)
+);
+
+CREATE INDEX bids_auction_id ON bids (auction_id, status);
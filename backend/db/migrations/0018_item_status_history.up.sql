@@ -0,0 +1,20 @@
+-- from_status is NULL for the creation of an item, and user_id when the
+-- server made the change
+CREATE TABLE item_status_history
+(
+    id          {{serial}},
+    item_id     integer NOT NULL,
+    from_status integer,
+    to_status   integer NOT NULL,
+    actor       varchar(20) NOT NULL,
+    user_id     integer,
+    created_at  {{timestamp}},
+    FOREIGN KEY(item_id) REFERENCES items(id),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX item_status_history_item_id ON item_status_history (item_id);
+
+-- the history of existing items starts with their current status
+INSERT INTO item_status_history (item_id, to_status, actor, created_at)
+SELECT id, status, 'system', updated_at FROM items;
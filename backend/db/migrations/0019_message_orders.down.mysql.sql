@@ -0,0 +1,3 @@
+DROP INDEX messages_order_id ON messages;
+
+ALTER TABLE messages DROP COLUMN order_id;
@@ -0,0 +1,3 @@
+DROP INDEX messages_order_id;
+
+ALTER TABLE messages DROP COLUMN order_id;
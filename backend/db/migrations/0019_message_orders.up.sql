@@ -0,0 +1,11 @@
+-- a private thread belongs to an order, so that the next buyer of an item
+-- whose order was cancelled does not see the thread of the previous one
+ALTER TABLE messages ADD COLUMN order_id integer;
+
+UPDATE messages SET order_id = (
+    SELECT orders.id FROM orders
+    WHERE orders.item_id = messages.item_id AND (orders.buyer_id = messages.sender_id OR orders.buyer_id = messages.recipient_id)
+    ORDER BY orders.id DESC LIMIT 1
+) WHERE is_private = 1;
+
+CREATE INDEX messages_order_id ON messages (order_id);
@@ -0,0 +1,5 @@
+-- when the seller shipped an order, which the escrow timeout counts from.
+-- Orders shipped before keep the time they got their status.
+ALTER TABLE orders ADD COLUMN shipped_at varchar(19);
+
+UPDATE orders SET shipped_at = updated_at WHERE status = 'shipped';
@@ -0,0 +1,9 @@
+-- blobs of deleted images, removed from the blob store by a background sweep
+-- once no image refers to them anymore
+CREATE TABLE image_deletions
+(
+    image_key  varchar(64) NOT NULL PRIMARY KEY,
+    created_at {{timestamp}}
+);
+
+CREATE INDEX image_deletions_created_at ON image_deletions (created_at);
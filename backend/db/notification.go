@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+var ErrSavedSearchNotFound = errors.New("saved search not found")
+
+type SavedSearchRepository interface {
+	AddSavedSearch(ctx context.Context, search domain.SavedSearch) (int64, error)
+	GetSavedSearches(ctx context.Context, userID int64) ([]domain.SavedSearch, error)
+	CountSavedSearches(ctx context.Context, userID int64) (int64, error)
+	DeleteSavedSearch(ctx context.Context, userID, id int64) error
+	// GetSavedSearchCandidates returns the saved searches of users other than
+	// the seller whose price and seller filters item passes. The caller
+	// matches the query and categories.
+	GetSavedSearchCandidates(ctx context.Context, item domain.Item) ([]domain.SavedSearch, error)
+}
+
+type SavedSearchDBRepository struct {
+	*DB
+}
+
+func NewSavedSearchRepository(db *DB) SavedSearchRepository {
+	return &SavedSearchDBRepository{DB: db}
+}
+
+const selectSavedSearches = "SELECT id, user_id, query, category_ids, min_price, max_price, seller_id, created_at FROM saved_searches "
+
+func (r *SavedSearchDBRepository) AddSavedSearch(ctx context.Context, search domain.SavedSearch) (int64, error) {
+	return insertID(ctx, r.DB, r.Dialect, "INSERT INTO saved_searches (user_id, query, category_ids, min_price, max_price, seller_id) VALUES (?, ?, ?, ?, ?, ?)",
+		search.UserID, search.Query, joinIDs(search.CategoryIDs), search.MinPrice, search.MaxPrice, search.SellerID)
+}
+
+func (r *SavedSearchDBRepository) GetSavedSearches(ctx context.Context, userID int64) ([]domain.SavedSearch, error) {
+	return r.querySavedSearches(ctx, selectSavedSearches+"WHERE user_id = ? ORDER BY id DESC", userID)
+}
+
+func (r *SavedSearchDBRepository) CountSavedSearches(ctx context.Context, userID int64) (int64, error) {
+	row := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM saved_searches WHERE user_id = ?", userID)
+
+	var count int64
+	return count, row.Scan(&count)
+}
+
+func (r *SavedSearchDBRepository) DeleteSavedSearch(ctx context.Context, userID, id int64) error {
+	rst, err := r.ExecContext(ctx, "DELETE FROM saved_searches WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(rst, ErrSavedSearchNotFound)
+}
+
+func (r *SavedSearchDBRepository) GetSavedSearchCandidates(ctx context.Context, item domain.Item) ([]domain.SavedSearch, error) {
+	return r.querySavedSearches(ctx, selectSavedSearches+`
+		WHERE user_id != ?
+		AND (min_price = 0 OR min_price <= ?)
+		AND (max_price = 0 OR max_price >= ?)
+		AND (seller_id = 0 OR seller_id = ?)
+		ORDER BY id`, item.UserID, item.Price, item.Price, item.UserID)
+}
+
+func (r *SavedSearchDBRepository) querySavedSearches(ctx context.Context, query string, args ...any) ([]domain.SavedSearch, error) {
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := make([]domain.SavedSearch, 0)
+	for rows.Next() {
+		var search domain.SavedSearch
+		var categoryIDs string
+		if err := rows.Scan(&search.ID, &search.UserID, &search.Query, &categoryIDs, &search.MinPrice, &search.MaxPrice, &search.SellerID, &search.CreatedAt); err != nil {
+			return nil, err
+		}
+		if search.CategoryIDs, err = splitIDs(categoryIDs); err != nil {
+			return nil, err
+		}
+		searches = append(searches, search)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+func joinIDs(ids []int64) string {
+	s := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s = append(s, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(s, ",")
+}
+
+func splitIDs(s string) ([]int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var ids []int64
+	for _, v := range strings.Split(s, ",") {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+type NotificationRepository interface {
+	AddNotifications(ctx context.Context, notifications []domain.Notification) error
+	GetNotifications(ctx context.Context, userID int64, unreadOnly bool, limit, offset int) ([]domain.Notification, error)
+	CountNotifications(ctx context.Context, userID int64, unreadOnly bool) (int64, error)
+	// MarkNotificationsRead marks the given notifications of the user as
+	// read, or all of them when ids is empty.
+	MarkNotificationsRead(ctx context.Context, userID int64, ids []int64) error
+}
+
+type NotificationDBRepository struct {
+	*DB
+}
+
+func NewNotificationRepository(db *DB) NotificationRepository {
+	return &NotificationDBRepository{DB: db}
+}
+
+func (r *NotificationDBRepository) AddNotifications(ctx context.Context, notifications []domain.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		for _, n := range notifications {
+			_, err := tx.ExecContext(ctx, "INSERT INTO notifications (user_id, type, item_id, saved_search_id) VALUES (?, ?, ?, ?)",
+				n.UserID, n.Type, n.ItemID, nullInt64(n.SavedSearchID))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func notificationsWhere(unreadOnly bool) string {
+	if unreadOnly {
+		return "notifications.user_id = ? AND notifications.is_read = 0"
+	}
+	return "notifications.user_id = ?"
+}
+
+func (r *NotificationDBRepository) GetNotifications(ctx context.Context, userID int64, unreadOnly bool, limit, offset int) ([]domain.Notification, error) {
+	rows, err := r.QueryContext(ctx, `
+		SELECT notifications.id, notifications.user_id, notifications.type, notifications.item_id, items.name,
+			notifications.saved_search_id, notifications.is_read, notifications.created_at
+		FROM notifications JOIN items ON items.id = notifications.item_id
+		WHERE `+notificationsWhere(unreadOnly)+`
+		ORDER BY notifications.id DESC LIMIT ? OFFSET ?`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make([]domain.Notification, 0)
+	for rows.Next() {
+		var n domain.Notification
+		var savedSearchID sql.NullInt64
+		var isRead int
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.ItemID, &n.ItemName, &savedSearchID, &isRead, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.SavedSearchID = savedSearchID.Int64
+		n.IsRead = isRead != 0
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (r *NotificationDBRepository) CountNotifications(ctx context.Context, userID int64, unreadOnly bool) (int64, error) {
+	row := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM notifications WHERE "+notificationsWhere(unreadOnly), userID)
+
+	var count int64
+	return count, row.Scan(&count)
+}
+
+func (r *NotificationDBRepository) MarkNotificationsRead(ctx context.Context, userID int64, ids []int64) error {
+	query := "UPDATE notifications SET is_read = 1 WHERE user_id = ?"
+	args := []any{userID}
+	if len(ids) > 0 {
+		query += " AND id IN (" + placeholders(len(ids)) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	_, err := r.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+type OfferRepository interface {
+	// AddOffer returns ErrOfferOpen when the buyer is still negotiating
+	// another offer on the item, ErrItemAuctioned when the item is sold by
+	// auction, ErrItemReserved or ErrItemNotOnSale when it is not on sale,
+	// and ErrInvalidOfferPrice when the offer is not lower than its price.
+	AddOffer(ctx context.Context, offer domain.Offer) (int64, error)
+	GetOffer(ctx context.Context, id int64) (domain.Offer, error)
+	// GetOffers lists the offers of the user, newest first. role limits them
+	// to the offers where the user takes that part, unless it is "".
+	GetOffers(ctx context.Context, userID int64, role domain.OrderRole, limit, offset int) ([]domain.Offer, error)
+	CountOffers(ctx context.Context, userID int64, role domain.OrderRole) (int64, error)
+	// AnswerOffer moves an offer from the status from to the status to at
+	// the given price. It returns ErrInvalidOfferStatus when the offer is
+	// not in from.
+	AnswerOffer(ctx context.Context, id int64, from, to domain.OfferStatus, price int64) error
+	// AcceptOffer accepts an offer in the status from, which reserves its
+	// item for the buyer until expiresAt. It returns ErrItemNotOnSale or
+	// ErrItemReserved when the item can not be reserved.
+	AcceptOffer(ctx context.Context, id int64, from domain.OfferStatus, expiresAt string) error
+}
+
+type OfferDBRepository struct {
+	*DB
+}
+
+func NewOfferRepository(db *DB) OfferRepository {
+	return &OfferDBRepository{DB: db}
+}
+
+var (
+	ErrOfferNotFound      = errors.New("offer not found")
+	ErrOfferOpen          = errors.New("an offer on the item is already open")
+	ErrInvalidOfferStatus = errors.New("invalid offer status")
+	ErrInvalidOfferPrice  = errors.New("offer has to be lower than the price")
+)
+
+const offerColumns = `offers.id, offers.item_id, items.name, offers.buyer_id, offers.seller_id,
+	offers.price, offers.status, offers.expires_at, offers.created_at, offers.updated_at`
+
+func scanOffer(row interface{ Scan(...any) error }) (domain.Offer, error) {
+	var o domain.Offer
+	var expiresAt sql.NullString
+	err := row.Scan(&o.ID, &o.ItemID, &o.ItemName, &o.BuyerID, &o.SellerID, &o.Price, &o.Status, &expiresAt, &o.CreatedAt, &o.UpdatedAt)
+	o.ExpiresAt = expiresAt.String
+	return o, err
+}
+
+func (r *OfferDBRepository) AddOffer(ctx context.Context, offer domain.Offer) (int64, error) {
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		// concurrent offers of the buyer wait here and then see this one
+		if err := lockItem(ctx, tx, offer.ItemID); err != nil {
+			return err
+		}
+		if err := checkNotAuctioned(ctx, tx, offer.ItemID); err != nil {
+			return err
+		}
+		var status domain.ItemStatus
+		var price int64
+		if err := tx.QueryRowContext(ctx, "SELECT status, price FROM items WHERE id = ?", offer.ItemID).Scan(&status, &price); err != nil {
+			return err
+		}
+		switch {
+		case status == domain.ItemStatusReserved:
+			return ErrItemReserved
+		case status != domain.ItemStatusOnSale:
+			return ErrItemNotOnSale
+		case offer.Price >= price:
+			return ErrInvalidOfferPrice
+		}
+
+		var count int64
+		row := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM offers WHERE item_id = ? AND buyer_id = ? AND status IN (?, ?)",
+			offer.ItemID, offer.BuyerID, domain.OfferStatusPending, domain.OfferStatusCountered)
+		if err := row.Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOfferOpen
+		}
+
+		var err error
+		id, err = insertID(ctx, tx, r.Dialect, "INSERT INTO offers (item_id, buyer_id, seller_id, price, status) VALUES (?, ?, ?, ?, ?)",
+			offer.ItemID, offer.BuyerID, offer.SellerID, offer.Price, domain.OfferStatusPending)
+		return err
+	})
+	return id, err
+}
+
+func (r *OfferDBRepository) GetOffer(ctx context.Context, id int64) (domain.Offer, error) {
+	row := r.QueryRowContext(ctx, "SELECT "+offerColumns+" FROM offers JOIN items ON items.id = offers.item_id WHERE offers.id = ?", id)
+	o, err := scanOffer(row)
+	if err == sql.ErrNoRows {
+		return domain.Offer{}, ErrOfferNotFound
+	}
+	return o, err
+}
+
+// offerFilter returns the WHERE clause of the offers of the user.
+func offerFilter(userID int64, role domain.OrderRole) (string, []any) {
+	switch role {
+	case domain.OrderRoleBuyer:
+		return "offers.buyer_id = ?", []any{userID}
+	case domain.OrderRoleSeller:
+		return "offers.seller_id = ?", []any{userID}
+	}
+	return "(offers.buyer_id = ? OR offers.seller_id = ?)", []any{userID, userID}
+}
+
+func (r *OfferDBRepository) GetOffers(ctx context.Context, userID int64, role domain.OrderRole, limit, offset int) ([]domain.Offer, error) {
+	where, args := offerFilter(userID, role)
+	rows, err := r.QueryContext(ctx, "SELECT "+offerColumns+" FROM offers JOIN items ON items.id = offers.item_id WHERE "+where+" ORDER BY offers.id DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	offers := make([]domain.Offer, 0)
+	for rows.Next() {
+		o, err := scanOffer(rows)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return offers, nil
+}
+
+func (r *OfferDBRepository) CountOffers(ctx context.Context, userID int64, role domain.OrderRole) (int64, error) {
+	where, args := offerFilter(userID, role)
+	row := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM offers WHERE "+where, args...)
+
+	var count int64
+	return count, row.Scan(&count)
+}
+
+func (r *OfferDBRepository) AnswerOffer(ctx context.Context, id int64, from, to domain.OfferStatus, price int64) error {
+	rst, err := r.ExecContext(ctx, "UPDATE offers SET status = ?, price = ?, updated_at = ? WHERE id = ? AND status = ?", to, price, now(), id, from)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(rst, ErrInvalidOfferStatus)
+}
+
+func (r *OfferDBRepository) AcceptOffer(ctx context.Context, id int64, from domain.OfferStatus, expiresAt string) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		rst, err := tx.ExecContext(ctx, "UPDATE offers SET status = ?, expires_at = ?, updated_at = ? WHERE id = ? AND status = ?",
+			domain.OfferStatusAccepted, expiresAt, now(), id, from)
+		if err != nil {
+			return err
+		}
+		if err := expectOneRow(rst, ErrInvalidOfferStatus); err != nil {
+			return err
+		}
+
+		offer := domain.Offer{Status: from}
+		row := tx.QueryRowContext(ctx, "SELECT item_id, buyer_id, seller_id, price FROM offers WHERE id = ?", id)
+		if err := row.Scan(&offer.ItemID, &offer.BuyerID, &offer.SellerID, &offer.Price); err != nil {
+			return err
+		}
+		// the party the offer was awaiting accepts it
+		actor, userID := domain.ItemActorSeller, offer.SellerID
+		if from.Awaiting() == domain.OrderRoleBuyer {
+			actor, userID = domain.ItemActorBuyer, offer.BuyerID
+		}
+		reservation := domain.Reservation{ItemID: offer.ItemID, BuyerID: offer.BuyerID, Price: offer.Price, OfferID: id, ExpiresAt: expiresAt}
+		_, err = reserveItem(ctx, tx, r.Dialect, reservation, actor, userID)
+		return err
+	})
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// OrderRepository reads orders. Orders are created and moved on by
+// TradeRepository, since most of their changes move money.
+type OrderRepository interface {
+	GetOrder(ctx context.Context, id int64) (domain.Order, error)
+	// GetItemOrder returns the latest order of the item, among the orders of
+	// the buyer unless buyerID is 0. It returns ErrOrderNotFound when there
+	// is none.
+	GetItemOrder(ctx context.Context, itemID int32, buyerID int64) (domain.Order, error)
+	// GetOrders lists the orders of the user, newest first. role limits them
+	// to the orders where the user takes that part, and status to the orders
+	// in that status, unless they are "".
+	GetOrders(ctx context.Context, userID int64, role domain.OrderRole, status domain.OrderStatus, limit, offset int) ([]domain.Order, error)
+	CountOrders(ctx context.Context, userID int64, role domain.OrderRole, status domain.OrderStatus) (int64, error)
+	// GetHeldAmount returns the money of the sales of the user that is held
+	// in escrow.
+	GetHeldAmount(ctx context.Context, sellerID int64) (int64, error)
+	// GetUnreceivedOrders lists the orders that have been shipped before the
+	// given time and not received yet, oldest first. Orders waiting for a
+	// cancellation are left out.
+	GetUnreceivedOrders(ctx context.Context, shippedBefore string) ([]domain.Order, error)
+	// GetUnshippedOrders lists the orders that have been paid before the
+	// given time and not shipped yet, oldest first.
+	GetUnshippedOrders(ctx context.Context, paidBefore string) ([]domain.Order, error)
+}
+
+type OrderDBRepository struct {
+	*DB
+}
+
+func NewOrderRepository(db *DB) OrderRepository {
+	return &OrderDBRepository{DB: db}
+}
+
+var ErrOrderNotFound = errors.New("order not found")
+
+const orderColumns = `orders.id, orders.item_id, items.name, orders.buyer_id, orders.seller_id,
+	orders.price, orders.status, orders.created_at, COALESCE(orders.shipped_at, ''), orders.updated_at`
+
+func scanOrder(row interface{ Scan(...any) error }) (domain.Order, error) {
+	var o domain.Order
+	err := row.Scan(&o.ID, &o.ItemID, &o.ItemName, &o.BuyerID, &o.SellerID, &o.Price, &o.Status, &o.CreatedAt, &o.ShippedAt, &o.UpdatedAt)
+	return o, err
+}
+
+func getOrder(ctx context.Context, q queryer, id int64) (domain.Order, error) {
+	row := q.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders JOIN items ON items.id = orders.item_id WHERE orders.id = ?", id)
+	o, err := scanOrder(row)
+	if err == sql.ErrNoRows {
+		return domain.Order{}, ErrOrderNotFound
+	}
+	return o, err
+}
+
+func (r *OrderDBRepository) GetOrder(ctx context.Context, id int64) (domain.Order, error) {
+	return getOrder(ctx, r.DB, id)
+}
+
+func (r *OrderDBRepository) GetItemOrder(ctx context.Context, itemID int32, buyerID int64) (domain.Order, error) {
+	where, args := "orders.item_id = ?", []any{itemID}
+	if buyerID != 0 {
+		where, args = where+" AND orders.buyer_id = ?", append(args, buyerID)
+	}
+	row := r.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders JOIN items ON items.id = orders.item_id WHERE "+where+" ORDER BY orders.id DESC LIMIT 1", args...)
+	o, err := scanOrder(row)
+	if err == sql.ErrNoRows {
+		return domain.Order{}, ErrOrderNotFound
+	}
+	return o, err
+}
+
+// orderFilter returns the WHERE clause of the orders of the user.
+func orderFilter(userID int64, role domain.OrderRole, status domain.OrderStatus) (string, []any) {
+	var where string
+	var args []any
+	switch role {
+	case domain.OrderRoleBuyer:
+		where, args = "orders.buyer_id = ?", []any{userID}
+	case domain.OrderRoleSeller:
+		where, args = "orders.seller_id = ?", []any{userID}
+	default:
+		where, args = "(orders.buyer_id = ? OR orders.seller_id = ?)", []any{userID, userID}
+	}
+	if status != "" {
+		where += " AND orders.status = ?"
+		args = append(args, status)
+	}
+	return where, args
+}
+
+func scanOrders(rows *sql.Rows) ([]domain.Order, error) {
+	defer rows.Close()
+
+	orders := make([]domain.Order, 0)
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *OrderDBRepository) GetOrders(ctx context.Context, userID int64, role domain.OrderRole, status domain.OrderStatus, limit, offset int) ([]domain.Order, error) {
+	where, args := orderFilter(userID, role, status)
+	rows, err := r.QueryContext(ctx, "SELECT "+orderColumns+" FROM orders JOIN items ON items.id = orders.item_id WHERE "+where+" ORDER BY orders.id DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanOrders(rows)
+}
+
+func (r *OrderDBRepository) CountOrders(ctx context.Context, userID int64, role domain.OrderRole, status domain.OrderStatus) (int64, error) {
+	where, args := orderFilter(userID, role, status)
+	row := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders WHERE "+where, args...)
+
+	var count int64
+	return count, row.Scan(&count)
+}
+
+// heldStatuses returns the placeholders and the arguments of
+// domain.HeldOrderStatuses.
+func heldStatuses() (string, []any) {
+	args := make([]any, 0, len(domain.HeldOrderStatuses))
+	for _, status := range domain.HeldOrderStatuses {
+		args = append(args, status)
+	}
+	return placeholders(len(args)), args
+}
+
+func (r *OrderDBRepository) GetHeldAmount(ctx context.Context, sellerID int64) (int64, error) {
+	held, args := heldStatuses()
+	row := r.QueryRowContext(ctx, "SELECT COALESCE(SUM(price), 0) FROM orders WHERE seller_id = ? AND status IN ("+held+")", append([]any{sellerID}, args...)...)
+
+	var amount int64
+	return amount, row.Scan(&amount)
+}
+
+func (r *OrderDBRepository) GetUnreceivedOrders(ctx context.Context, shippedBefore string) ([]domain.Order, error) {
+	rows, err := r.QueryContext(ctx, `
+		SELECT `+orderColumns+` FROM orders JOIN items ON items.id = orders.item_id
+		WHERE orders.status = ? AND orders.shipped_at <= ?
+		AND NOT EXISTS (SELECT 1 FROM cancellations WHERE cancellations.order_id = orders.id AND cancellations.status = ?)
+		ORDER BY orders.id`,
+		domain.OrderStatusShipped, shippedBefore, domain.CancellationStatusRequested)
+	if err != nil {
+		return nil, err
+	}
+	return scanOrders(rows)
+}
+
+func (r *OrderDBRepository) GetUnshippedOrders(ctx context.Context, paidBefore string) ([]domain.Order, error) {
+	rows, err := r.QueryContext(ctx, "SELECT "+orderColumns+" FROM orders JOIN items ON items.id = orders.item_id WHERE orders.status = ? AND orders.created_at <= ? ORDER BY orders.id",
+		domain.OrderStatusPaid, paidBefore)
+	if err != nil {
+		return nil, err
+	}
+	return scanOrders(rows)
+}
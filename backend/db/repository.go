@@ -2,8 +2,8 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
 )
@@ -12,14 +12,14 @@ type UserRepository interface {
 	AddUser(ctx context.Context, user domain.User) (int64, error)
 	GetUser(ctx context.Context, id int64) (domain.User, error)
 	GetUserByName(ctx context.Context, userName string) (domain.User, error)
-	UpdateBalance(ctx context.Context, id int64, balance int64) error
+	IsAdmin(ctx context.Context, id int64) (bool, error)
 }
 
 type UserDBRepository struct {
-	*sql.DB
+	*DB
 }
 
-func NewUserRepository(db *sql.DB) UserRepository {
+func NewUserRepository(db *DB) UserRepository {
 	return &UserDBRepository{DB: db}
 }
 
@@ -33,12 +33,7 @@ func (r *UserDBRepository) AddUser(ctx context.Context, user domain.User) (int64
 		return 0, err
 	}
 
-	rst, err := tx.ExecContext(ctx, "INSERT INTO users (name, password) VALUES (?, ?) ", user.Name, user.Password)
-	if err != nil {
-		tx.Rollback()
-		return 0, err
-	}
-	id, err := rst.LastInsertId()
+	id, err := insertID(ctx, tx, r.Dialect, "INSERT INTO users (name, password) VALUES (?, ?)", user.Name, user.Password)
 	if err != nil {
 		tx.Rollback()
 		return 0, err
@@ -64,156 +59,149 @@ func (r *UserDBRepository) GetUserByName(ctx context.Context, userName string) (
 	return user, row.Scan(&user.ID, &user.Name, &user.Password, &user.Balance)
 }
 
-func (r *UserDBRepository) UpdateBalance(ctx context.Context, id int64, balance int64) error {
-	if _, err := r.ExecContext(ctx, "UPDATE users SET balance = ? WHERE id = ?", balance, id); err != nil {
-		return err
+func (r *UserDBRepository) IsAdmin(ctx context.Context, id int64) (bool, error) {
+	row := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM admins WHERE user_id = ?", id)
+
+	var count int64
+	if err := row.Scan(&count); err != nil {
+		return false, err
 	}
-	return nil
+	return count > 0, nil
+}
+
+func now() string {
+	return time.Now().Format(domain.TimestampLayout)
+}
+
+// touchItem bumps updated_at of the item, which is served as the
+// Last-Modified of its images.
+func touchItem(ctx context.Context, q queryer, id int32) error {
+	_, err := q.ExecContext(ctx, "UPDATE items SET updated_at = ? WHERE id = ?", now(), id)
+	return err
 }
 
 type ItemRepository interface {
-	AddItem(ctx context.Context, item domain.Item) (int64, error)
+	AddItem(ctx context.Context, item domain.Item, images []domain.ItemImage) (int64, error)
 	GetItem(ctx context.Context, id int32) (domain.Item, error)
-	GetItemImage(ctx context.Context, id int32) ([]byte, error)
-	GetItems(ctx context.Context, onSaleOnly bool) ([]domain.ItemWithCategory, error)
-	GetItemsByUserID(ctx context.Context, userID int64) ([]domain.Item, error)
+	GetItems(ctx context.Context, onSaleOnly bool, opts ItemListOptions) (ItemPage, error)
+	// GetItemsByUserID lists the items of the seller, except the deleted ones.
+	GetItemsByUserID(ctx context.Context, userID int64, opts ItemListOptions) (ItemPage, error)
 	GetCategory(ctx context.Context, id int64) (domain.Category, error)
 	GetCategories(ctx context.Context) ([]domain.Category, error)
-	UpdateItemStatus(ctx context.Context, id int32, status domain.ItemStatus) error
-	SearchItem(ctx context.Context, itemName string) ([]domain.ItemWithCategory, error)
+	// MoveItem changes the status of an item from the status from to the
+	// status to on behalf of the actor, who is the user userID unless it is
+	// the system. It returns ErrInvalidItemStatus when the item is not in the
+	// status from, or when domain.ItemTransitions has no such move for the
+	// actor.
+	MoveItem(ctx context.Context, id int32, from, to domain.ItemStatus, actor domain.ItemActor, userID int64) error
+	// WithdrawItem takes an item of the seller off sale, back to a draft,
+	// paused or deleted. The open offers on the item are rejected unless it
+	// is only paused. It returns ErrItemAuctioned when the item is sold by an
+	// open auction, and ErrInvalidItemStatus when the item can not move to
+	// the status to.
+	WithdrawItem(ctx context.Context, id int32, to domain.ItemStatus, sellerID int64) error
+	// GetItemHistory lists the changes of status of an item, oldest first.
+	GetItemHistory(ctx context.Context, id int32) ([]domain.ItemStatusChange, error)
+	SearchItem(ctx context.Context, text string, filter ItemFilter, opts ItemListOptions) (ItemPage, error)
+	SearchFacets(ctx context.Context, text string, filter ItemFilter) (ItemFacets, error)
 	EditItem(ctx context.Context, id int32, name string, categoryID int64, price int64, desc string) error
 }
 
 type ItemDBRepository struct {
-	*sql.DB
+	*DB
 }
 
-func NewItemRepository(db *sql.DB) ItemRepository {
+func NewItemRepository(db *DB) ItemRepository {
 	return &ItemDBRepository{DB: db}
 }
 
-func (r *ItemDBRepository) AddItem(ctx context.Context, item domain.Item) (int64, error) {
-	rst, err := r.ExecContext(ctx, "INSERT INTO items (name, price, description, category_id, seller_id, image, status) VALUES (?, ?, ?, ?, ?, ?, ?)", item.Name, item.Price, item.Description, item.CategoryID, item.UserID, item.Image, item.Status)
-	if err != nil {
-		return 0, err
-	}
-	lastID, err2 := rst.LastInsertId()
-	if err2 != nil {
-		return 0, ErrConflict // idのconflictがおきたとき
-	}
-
-	return lastID, nil
+func (r *ItemDBRepository) AddItem(ctx context.Context, item domain.Item, images []domain.ItemImage) (int64, error) {
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		var err error
+		id, err = insertID(ctx, tx, r.Dialect, "INSERT INTO items (name, price, description, category_id, seller_id, status) VALUES (?, ?, ?, ?, ?, ?)", item.Name, item.Price, item.Description, item.CategoryID, item.UserID, item.Status)
+		if err != nil {
+			return err
+		}
+		if err := indexItem(ctx, tx, int32(id)); err != nil {
+			return err
+		}
+		if err := addItemStatusChange(ctx, tx, domain.ItemStatusChange{ItemID: int32(id), To: item.Status, Actor: domain.ItemActorSeller, UserID: item.UserID}); err != nil {
+			return err
+		}
+		_, err = addItemImages(ctx, tx, int32(id), images)
+		return err
+	})
+	return id, err
 }
 
 func (r *ItemDBRepository) GetItem(ctx context.Context, id int32) (domain.Item, error) {
-	row := r.QueryRowContext(ctx, "SELECT * FROM items WHERE id = ?", id)
+	row := r.QueryRowContext(ctx, selectItems+"WHERE id = ?", id)
 
 	var item domain.Item
-	return item, row.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt)
+	return item, row.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.BuyerID, &item.Status, &item.CreatedAt, &item.UpdatedAt)
 }
 
-const selectItemsWithCat = `
-		SELECT
+// selectItems never reads the legacy image column, images are in item_images.
+const selectItems = `
+		SELECT id, name, price, description, COALESCE(category_id, 0), seller_id, COALESCE(buyer_id, 0), status, created_at, updated_at
+		FROM items
+		`
+
+const itemWithCatColumns = `
 			items.id,
 			items.name,
 			items.price,
 			items.description,
-			items.category_id,
+			COALESCE(items.category_id, 0),
 			items.seller_id,
-			items.image,
+			COALESCE(items.buyer_id, 0),
 			items.status,
 			items.created_at,
 			items.updated_at,
 			category.id as category_id_c,
 			category.name as category_name
-		FROM items
+		`
+
+const itemsWithCat = `
+		items
 		LEFT OUTER JOIN category
 		ON items.category_id = category.id
 		`
 
-func (r *ItemDBRepository) SearchItem(ctx context.Context, itemName string) ([]domain.ItemWithCategory, error) {
-	rows, err := r.QueryContext(ctx, selectItemsWithCat+"WHERE items.name LIKE ?", "%"+itemName+"%")
+// SearchItem finds the items matching filter whose name, description or
+// category contain words starting with every word of text, ignoring width,
+// case and katakana versus hiragana. Japanese and other CJK text matches
+// anywhere within a word. Items found by a search have a Snippet whose
+// matches are enclosed in SnippetOpen and SnippetClose.
+func (r *ItemDBRepository) SearchItem(ctx context.Context, text string, filter ItemFilter, opts ItemListOptions) (ItemPage, error) {
+	page, err := listItems(ctx, r.DB, filter.apply(searchQuery(r.Dialect, text), true, true), opts)
 	if err != nil {
-		return nil, err
+		return page, err
 	}
-
-	defer rows.Close()
-
-	items := make([]domain.ItemWithCategory, 0)
-	for rows.Next() {
-		var item domain.Item
-		var category domain.Category
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt, &category.ID, &category.Name); err != nil {
-			return nil, err
-		}
-		items = append(items, domain.ItemWithCategory{Item: item, Category: category})
-	}
-	if rows.Err() != nil {
-		return nil, err
+	for i, item := range page.Items {
+		page.Items[i].Snippet = highlightItem(item.Item.Name, item.Item.Description, text)
 	}
-	return items, nil
+	return page, nil
 }
 
-func (r *ItemDBRepository) GetItemImage(ctx context.Context, id int32) ([]byte, error) {
-	row := r.QueryRowContext(ctx, "SELECT image FROM items WHERE id = ?", id)
-	var image []byte
-	return image, row.Scan(&image)
+func (r *ItemDBRepository) SearchFacets(ctx context.Context, text string, filter ItemFilter) (ItemFacets, error) {
+	return searchFacets(ctx, r.DB, searchQuery(r.Dialect, text), filter)
 }
 
-func (r *ItemDBRepository) GetItems(ctx context.Context, onSaleOnly bool) ([]domain.ItemWithCategory, error) {
-	var rows *sql.Rows
-	var err error
+func (r *ItemDBRepository) GetItems(ctx context.Context, onSaleOnly bool, opts ItemListOptions) (ItemPage, error) {
 	if onSaleOnly {
-		rows, err = r.QueryContext(ctx, selectItemsWithCat+"WHERE status = ? ORDER BY updated_at desc", domain.ItemStatusOnSale)
-	} else {
-		rows, err = r.QueryContext(ctx, selectItemsWithCat+"WHERE status = ? OR status = ? ORDER BY updated_at desc", domain.ItemStatusOnSale, domain.ItemStatusSoldOut)
+		return listItems(ctx, r.DB, itemQuery{where: "items.status = ?", args: []any{domain.ItemStatusOnSale}}, opts)
 	}
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	items := make([]domain.ItemWithCategory, 0)
-	for rows.Next() {
-		var item domain.Item
-		var category domain.Category
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt, &category.ID, &category.Name); err != nil {
-			return nil, err
-		}
-		items = append(items, domain.ItemWithCategory{Item: item, Category: category})
-	}
-	if rows.Err() != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
-func (r *ItemDBRepository) GetItemsByUserID(ctx context.Context, userID int64) ([]domain.Item, error) {
-	rows, err := r.QueryContext(ctx, "SELECT * FROM items WHERE seller_id = ?", userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var items []domain.Item
-	for rows.Next() {
-		var item domain.Item
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Description, &item.CategoryID, &item.UserID, &item.Image, &item.Status, &item.CreatedAt, &item.UpdatedAt); err != nil {
-			return nil, err
-		}
-		items = append(items, item)
+	args := make([]any, 0, len(domain.PublicItemStatuses))
+	for _, status := range domain.PublicItemStatuses {
+		args = append(args, status)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+	return listItems(ctx, r.DB, itemQuery{where: "items.status IN (" + placeholders(len(args)) + ")", args: args}, opts)
 }
 
-func (r *ItemDBRepository) UpdateItemStatus(ctx context.Context, id int32, status domain.ItemStatus) error {
-	if _, err := r.ExecContext(ctx, "UPDATE items SET status = ? WHERE id = ?", status, id); err != nil {
-		return err
-	}
-	return nil
+func (r *ItemDBRepository) GetItemsByUserID(ctx context.Context, userID int64, opts ItemListOptions) (ItemPage, error) {
+	return listItems(ctx, r.DB, itemQuery{where: "items.seller_id = ? AND items.status <> ?", args: []any{userID, domain.ItemStatusDeleted}}, opts)
 }
 
 func (r *ItemDBRepository) GetCategory(ctx context.Context, id int64) (domain.Category, error) {
@@ -244,12 +232,27 @@ func (r *ItemDBRepository) GetCategories(ctx context.Context) ([]domain.Category
 	return cats, nil
 }
 
+// EditItem changes an item the seller can still edit. It fails with
+// ErrInvalidItemStatus when the item is held or sold and with ErrItemAuctioned
+// while it is auctioned. The UPDATE checks the status itself and locks the
+// item, which a purchase or an auction starting meanwhile has to update too,
+// so neither is ever overwritten.
 func (r *ItemDBRepository) EditItem(ctx context.Context, id int32, name string, categoryID int64, price int64, desc string) error {
-
-	_, err := r.ExecContext(ctx, "UPDATE items SET name=?, category_id=?, price=?, description=? WHERE id=?", name, categoryID, price, desc, id)
-	if err != nil {
-		return err
-	}
-	return nil
-
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		args := []any{name, categoryID, price, desc, now(), id}
+		for _, status := range domain.EditableItemStatuses {
+			args = append(args, status)
+		}
+		rst, err := tx.ExecContext(ctx, "UPDATE items SET name=?, category_id=?, price=?, description=?, updated_at=? WHERE id=? AND status IN ("+placeholders(len(domain.EditableItemStatuses))+")", args...)
+		if err != nil {
+			return err
+		}
+		if err := expectOneRow(rst, ErrInvalidItemStatus); err != nil {
+			return err
+		}
+		if err := checkNotAuctioned(ctx, tx, id); err != nil {
+			return err
+		}
+		return indexItem(ctx, tx, id)
+	})
 }
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+type ReservationRepository interface {
+	// Reserve holds an item on sale for the buyer at its listed price until
+	// expiresAt. It returns ErrItemReserved when the item is already held,
+	// ErrItemAuctioned when it is sold by auction, ErrItemNotOnSale when it
+	// is not on sale, and ErrReservationCooldown or ErrTooManyReservations
+	// when limits refuses the hold.
+	Reserve(ctx context.Context, itemID int32, buyerID int64, expiresAt string, limits ReservationLimits) (domain.Reservation, error)
+	// GetActiveReservation returns the hold on the item, which may have
+	// expired without being released yet.
+	GetActiveReservation(ctx context.Context, itemID int32) (domain.Reservation, error)
+	// GetExpiredReservations lists the active reservations that expired
+	// before the given time, oldest first.
+	GetExpiredReservations(ctx context.Context, before string) ([]domain.Reservation, error)
+	// ReleaseReservation ends an active reservation with the given status
+	// and puts its item back on sale. It returns ErrReservationNotActive
+	// when the reservation has already ended.
+	ReleaseReservation(ctx context.Context, id int64, status domain.ReservationStatus) error
+}
+
+type ReservationDBRepository struct {
+	*DB
+}
+
+func NewReservationRepository(db *DB) ReservationRepository {
+	return &ReservationDBRepository{DB: db}
+}
+
+var (
+	ErrReservationNotFound  = errors.New("reservation not found")
+	ErrReservationNotActive = errors.New("reservation is not active")
+	ErrReservationCooldown  = errors.New("item was held by the user too recently")
+	ErrTooManyReservations  = errors.New("user holds too many items")
+)
+
+// ReservationLimits keep a buyer from holding items off the market. Zero
+// values do not limit. Holds from accepted offers are agreed by the seller
+// and never limited.
+type ReservationLimits struct {
+	// CooldownSince refuses a hold on an item whose last hold by the same
+	// buyer ended after it.
+	CooldownSince string
+	// MaxActive is how many items a buyer can hold at once.
+	MaxActive int
+}
+
+const reservationColumns = `id, item_id, buyer_id, price, offer_id, status, expires_at, created_at, updated_at`
+
+func scanReservation(row interface{ Scan(...any) error }) (domain.Reservation, error) {
+	var r domain.Reservation
+	var offerID sql.NullInt64
+	err := row.Scan(&r.ID, &r.ItemID, &r.BuyerID, &r.Price, &offerID, &r.Status, &r.ExpiresAt, &r.CreatedAt, &r.UpdatedAt)
+	r.OfferID = offerID.Int64
+	return r, err
+}
+
+func activeReservation(ctx context.Context, q queryer, itemID int32) (domain.Reservation, error) {
+	row := q.QueryRowContext(ctx, "SELECT "+reservationColumns+" FROM reservations WHERE item_id = ? AND status = ? ORDER BY id DESC LIMIT 1",
+		itemID, domain.ReservationStatusActive)
+	r, err := scanReservation(row)
+	if err == sql.ErrNoRows {
+		return domain.Reservation{}, ErrReservationNotFound
+	}
+	return r, err
+}
+
+// reserveItem marks an item on sale as reserved and adds the reservation r,
+// on behalf of the actor userID. An expired hold that has not been released
+// yet is released first.
+func reserveItem(ctx context.Context, tx *Tx, d Dialect, r domain.Reservation, actor domain.ItemActor, userID int64) (int64, error) {
+	// concurrent holds of the item wait here and then see this one
+	if err := lockItem(ctx, tx, r.ItemID); err != nil {
+		return 0, err
+	}
+	if err := checkNotAuctioned(ctx, tx, r.ItemID); err != nil {
+		return 0, err
+	}
+	current, err := activeReservation(ctx, tx, r.ItemID)
+	switch {
+	case err == ErrReservationNotFound:
+	case err != nil:
+		return 0, err
+	case current.ExpiresAt > now():
+		return 0, ErrItemReserved
+	default:
+		if err := releaseReservation(ctx, tx, current.ID, domain.ReservationStatusExpired); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := moveItem(ctx, tx, r.ItemID, domain.ItemStatusReserved, actor, userID, ErrItemNotOnSale); err != nil {
+		return 0, err
+	}
+	return insertID(ctx, tx, d, "INSERT INTO reservations (item_id, buyer_id, price, offer_id, status, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		r.ItemID, r.BuyerID, r.Price, nullInt64(r.OfferID), domain.ReservationStatusActive, r.ExpiresAt)
+}
+
+// releaseReservation ends an active reservation with the given status, and
+// puts its item back on sale unless another buyer holds it. A released hold
+// is given up by its buyer, and any other by the system.
+func releaseReservation(ctx context.Context, tx *Tx, id int64, status domain.ReservationStatus) error {
+	rst, err := tx.ExecContext(ctx, "UPDATE reservations SET status = ?, updated_at = ? WHERE id = ? AND status = ?", status, now(), id, domain.ReservationStatusActive)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(rst, ErrReservationNotActive); err != nil {
+		return err
+	}
+
+	var itemID int32
+	var buyerID int64
+	if err := tx.QueryRowContext(ctx, "SELECT item_id, buyer_id FROM reservations WHERE id = ?", id).Scan(&itemID, &buyerID); err != nil {
+		return err
+	}
+	var count int64
+	row := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM reservations WHERE item_id = ? AND status = ?", itemID, domain.ReservationStatusActive)
+	if err := row.Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	actor, userID := domain.ItemActorSystem, int64(0)
+	if status == domain.ReservationStatusReleased {
+		actor, userID = domain.ItemActorBuyer, buyerID
+	}
+	return moveItem(ctx, tx, itemID, domain.ItemStatusOnSale, actor, userID, ErrItemNotOnSale)
+}
+
+// checkReservationLimits refuses a hold of the buyer on an item when limits
+// does not allow it. The buyer is locked first, so that concurrent holds of
+// the buyer count each other.
+func checkReservationLimits(ctx context.Context, tx *Tx, itemID int32, buyerID int64, limits ReservationLimits) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET balance = balance WHERE id = ?", buyerID); err != nil {
+		return err
+	}
+
+	if limits.CooldownSince != "" {
+		last, err := scanReservation(tx.QueryRowContext(ctx, "SELECT "+reservationColumns+" FROM reservations WHERE item_id = ? AND buyer_id = ? AND offer_id IS NULL AND status <> ? ORDER BY id DESC LIMIT 1",
+			itemID, buyerID, domain.ReservationStatusPurchased))
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		// a hold ends when it expires unless it is given up before; an
+		// active hold that has not expired is refused as ErrItemReserved
+		endedAt := last.ExpiresAt
+		if last.Status == domain.ReservationStatusReleased && last.UpdatedAt < endedAt {
+			endedAt = last.UpdatedAt
+		}
+		if err == nil && endedAt <= now() && endedAt > limits.CooldownSince {
+			return ErrReservationCooldown
+		}
+	}
+
+	if limits.MaxActive > 0 {
+		var count int
+		row := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM reservations WHERE buyer_id = ? AND offer_id IS NULL AND status = ? AND expires_at > ?",
+			buyerID, domain.ReservationStatusActive, now())
+		if err := row.Scan(&count); err != nil {
+			return err
+		}
+		if count >= limits.MaxActive {
+			return ErrTooManyReservations
+		}
+	}
+	return nil
+}
+
+func (r *ReservationDBRepository) Reserve(ctx context.Context, itemID int32, buyerID int64, expiresAt string, limits ReservationLimits) (domain.Reservation, error) {
+	reservation := domain.Reservation{ItemID: itemID, BuyerID: buyerID, Status: domain.ReservationStatusActive, ExpiresAt: expiresAt}
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		if err := checkReservationLimits(ctx, tx, itemID, buyerID, limits); err != nil {
+			return err
+		}
+		if err := tx.QueryRowContext(ctx, "SELECT price FROM items WHERE id = ?", itemID).Scan(&reservation.Price); err != nil {
+			return err
+		}
+		var err error
+		reservation.ID, err = reserveItem(ctx, tx, r.Dialect, reservation, domain.ItemActorBuyer, buyerID)
+		return err
+	})
+	return reservation, err
+}
+
+func (r *ReservationDBRepository) GetActiveReservation(ctx context.Context, itemID int32) (domain.Reservation, error) {
+	return activeReservation(ctx, r.DB, itemID)
+}
+
+func (r *ReservationDBRepository) GetExpiredReservations(ctx context.Context, before string) ([]domain.Reservation, error) {
+	rows, err := r.QueryContext(ctx, "SELECT "+reservationColumns+" FROM reservations WHERE status = ? AND expires_at <= ? ORDER BY id",
+		domain.ReservationStatusActive, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := make([]domain.Reservation, 0)
+	for rows.Next() {
+		res, err := scanReservation(rows)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+func (r *ReservationDBRepository) ReleaseReservation(ctx context.Context, id int64, status domain.ReservationStatus) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		return releaseReservation(ctx, tx, id, status)
+	})
+}
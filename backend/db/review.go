@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+type ReviewRepository interface {
+	// AddReview returns ErrAlreadyReviewed when the reviewer has already
+	// reviewed the order.
+	AddReview(ctx context.Context, review domain.Review) (int64, error)
+	// GetReviews lists the reviews of the user, newest first.
+	GetReviews(ctx context.Context, revieweeID int64, limit, offset int) ([]domain.Review, error)
+	GetRatingSummary(ctx context.Context, userID int64) (domain.RatingSummary, error)
+}
+
+type ReviewDBRepository struct {
+	*DB
+}
+
+func NewReviewRepository(db *DB) ReviewRepository {
+	return &ReviewDBRepository{DB: db}
+}
+
+var ErrAlreadyReviewed = errors.New("order is already reviewed")
+
+func (r *ReviewDBRepository) AddReview(ctx context.Context, review domain.Review) (int64, error) {
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		var count int64
+		row := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM reviews WHERE order_id = ? AND reviewer_id = ?", review.OrderID, review.ReviewerID)
+		if err := row.Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyReviewed
+		}
+
+		var err error
+		id, err = insertID(ctx, tx, r.Dialect, "INSERT INTO reviews (order_id, reviewer_id, reviewee_id, rating, comment) VALUES (?, ?, ?, ?, ?)",
+			review.OrderID, review.ReviewerID, review.RevieweeID, review.Rating, review.Comment)
+		if isUniqueViolation(err) {
+			// a concurrent review was added after the count
+			return ErrAlreadyReviewed
+		}
+		return err
+	})
+	return id, err
+}
+
+func (r *ReviewDBRepository) GetReviews(ctx context.Context, revieweeID int64, limit, offset int) ([]domain.Review, error) {
+	rows, err := r.QueryContext(ctx, `
+		SELECT reviews.id, reviews.order_id, orders.item_id, items.name, reviews.reviewer_id, users.name, orders.buyer_id,
+			reviews.reviewee_id, reviews.rating, reviews.comment, reviews.created_at
+		FROM reviews
+		JOIN orders ON orders.id = reviews.order_id
+		JOIN items ON items.id = orders.item_id
+		JOIN users ON users.id = reviews.reviewer_id
+		WHERE reviews.reviewee_id = ?
+		ORDER BY reviews.id DESC LIMIT ? OFFSET ?`, revieweeID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make([]domain.Review, 0)
+	for rows.Next() {
+		var rv domain.Review
+		var buyerID int64
+		if err := rows.Scan(&rv.ID, &rv.OrderID, &rv.ItemID, &rv.ItemName, &rv.ReviewerID, &rv.ReviewerName, &buyerID,
+			&rv.RevieweeID, &rv.Rating, &rv.Comment, &rv.CreatedAt); err != nil {
+			return nil, err
+		}
+		rv.ReviewerRole = domain.OrderRoleSeller
+		if rv.ReviewerID == buyerID {
+			rv.ReviewerRole = domain.OrderRoleBuyer
+		}
+		reviews = append(reviews, rv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+func (r *ReviewDBRepository) GetRatingSummary(ctx context.Context, userID int64) (domain.RatingSummary, error) {
+	rows, err := r.QueryContext(ctx, "SELECT rating, COUNT(*) FROM reviews WHERE reviewee_id = ? GROUP BY rating", userID)
+	if err != nil {
+		return domain.RatingSummary{}, err
+	}
+	defer rows.Close()
+
+	var summary domain.RatingSummary
+	for rows.Next() {
+		var rating domain.Rating
+		var count int64
+		if err := rows.Scan(&rating, &count); err != nil {
+			return domain.RatingSummary{}, err
+		}
+		switch rating {
+		case domain.RatingGood:
+			summary.Good = count
+		case domain.RatingNormal:
+			summary.Normal = count
+		case domain.RatingBad:
+			summary.Bad = count
+		}
+	}
+	return summary, rows.Err()
+}
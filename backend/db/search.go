@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/textsearch"
+)
+
+// Snippets mark the matched terms with these bytes, which never occur in item
+// text, and leave escaping and markup to the caller.
+const (
+	SnippetOpen  = "\x02"
+	SnippetClose = "\x03"
+)
+
+// searchQuery selects the items matching every term of text in item_search.
+// Terms match as prefixes of the words in the name, description and category
+// of an item, after both are normalized by package textsearch.
+func searchQuery(d Dialect, text string) itemQuery {
+	terms := textsearch.Query(text)
+	if len(terms) == 0 {
+		return itemQuery{where: "1 = 1", rank: "items.created_at DESC"}
+	}
+
+	if d.fts5 {
+		// tokens only consist of letters and numbers, so need no quoting
+		match := make([]string, 0, len(terms))
+		for _, term := range terms {
+			m := `"` + term.Phrase() + `"`
+			if term.Prefix {
+				m += "*"
+			}
+			match = append(match, m)
+		}
+		return itemQuery{
+			from:  "items_fts JOIN items ON items.id = items_fts.rowid LEFT OUTER JOIN category ON items.category_id = category.id",
+			where: "items_fts MATCH ?",
+			args:  []any{strings.Join(match, " ")},
+			// bm25 is smaller for better matches; a match in the name weighs
+			// the most
+			rank: "bm25(items_fts, 10.0, 1.0, 5.0)",
+		}
+	}
+
+	// the other backends have no index and score matches by column instead.
+	// Tokens are separated by single spaces, so a term matches at the start
+	// of the text or after a space.
+	like := func(column string) string {
+		return "(" + column + " LIKE ? ESCAPE '!' OR " + column + " LIKE ? ESCAPE '!')"
+	}
+	q := itemQuery{from: itemsWithCat + " JOIN item_search ON item_search.item_id = items.id"}
+	var where, rank []string
+	for _, term := range terms {
+		start := escapeLike(term.Phrase()) + "%"
+		args := []any{start, "% " + start}
+		where = append(where, "("+like("item_search.name")+" OR "+like("item_search.description")+" OR "+like("item_search.category")+")")
+		q.args = append(q.args, args[0], args[1], args[0], args[1], args[0], args[1])
+		rank = append(rank, "CASE WHEN "+like("item_search.name")+" THEN 10 ELSE 0 END + CASE WHEN "+like("item_search.category")+" THEN 5 ELSE 0 END + CASE WHEN "+like("item_search.description")+" THEN 1 ELSE 0 END")
+		q.rankArgs = append(q.rankArgs, args[0], args[1], args[0], args[1], args[0], args[1])
+	}
+	q.where = strings.Join(where, " AND ")
+	q.rank = "(" + strings.Join(rank, " + ") + ") DESC"
+	return q
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// highlightItem builds the snippet of a found item from its description, or
+// from its name when text only occurs there.
+func highlightItem(name, description, text string) string {
+	if s := textsearch.Highlight(description, text, SnippetOpen, SnippetClose); s != "" {
+		return s
+	}
+	return textsearch.Highlight(name, text, SnippetOpen, SnippetClose)
+}
+
+// indexItem writes the search text of an item to item_search.
+func indexItem(ctx context.Context, q queryer, id int32) error {
+	var name, description string
+	var category *string
+	err := q.QueryRowContext(ctx, "SELECT items.name, items.description, category.name FROM "+itemsWithCat+" WHERE items.id = ?", id).
+		Scan(&name, &description, &category)
+	if err != nil {
+		return err
+	}
+	categoryName := ""
+	if category != nil {
+		categoryName = *category
+	}
+
+	if _, err := q.ExecContext(ctx, "DELETE FROM item_search WHERE item_id = ?", id); err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, "INSERT INTO item_search (item_id, name, description, category) VALUES (?, ?, ?, ?)",
+		id, textsearch.IndexText(name), textsearch.IndexText(description), textsearch.IndexText(categoryName))
+	return err
+}
+
+// IndexItems indexes the items missing from item_search, e.g. rows loaded
+// from seed data. It returns the number of items indexed.
+func IndexItems(ctx context.Context, db *DB) (int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id FROM items WHERE NOT EXISTS (SELECT 1 FROM item_search WHERE item_search.item_id = items.id)")
+	if err != nil {
+		return 0, err
+	}
+	var ids []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	err = withTx(ctx, db, func(tx *Tx) error {
+		for _, id := range ids {
+			if err := indexItem(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
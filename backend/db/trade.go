@@ -0,0 +1,466 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// TradeRepository moves money between users. Every method runs in a single
+// transaction and records each balance change in the ledger.
+type TradeRepository interface {
+	TopUp(ctx context.Context, userID int64, amount int64) error
+	// Purchase debits the buyer and marks the item as sold out. The money is
+	// held in the returned order until the buyer receives the item. While the
+	// item is reserved, only the holder can purchase it, at the price of the
+	// reservation, and others get ErrItemReserved. Items sold by auction
+	// fail with ErrItemAuctioned.
+	Purchase(ctx context.Context, buyerID int64, itemID int32) (int64, error)
+	// AdvanceOrder makes the transition t on an order, and credits the
+	// seller when the order is received. It returns ErrInvalidOrderStatus
+	// when the order is not in t.From.
+	AdvanceOrder(ctx context.Context, orderID int64, t domain.OrderTransition) error
+	// ApproveCancellation cancels the order of a requested cancellation on
+	// behalf of the party approverID and refunds the buyer. It returns ErrCancellationNotRequested when the
+	// cancellation has already been resolved, and ErrInvalidOrderStatus
+	// when the money of the order is not held anymore.
+	ApproveCancellation(ctx context.Context, cancellationID int64, approverID int64) error
+	// ForceRefund cancels an order whose money is still held and refunds
+	// the buyer on behalf of the admin adminID, resolving the requested
+	// cancellation of the order if there is one.
+	ForceRefund(ctx context.Context, orderID int64, adminID int64, reason string) error
+	// CancelUnshipped cancels a paid order the seller has not shipped in
+	// time and refunds the buyer, approving the requested cancellation of the
+	// order if there is one. It returns ErrInvalidOrderStatus when the order
+	// is not paid anymore.
+	CancelUnshipped(ctx context.Context, orderID int64) error
+	// PlaceBid holds amount from the balance of the bidder as the highest
+	// bid of an open auction, gives back the bid it outbids, and returns
+	// both. An auction ending before extendTo is extended to it. It returns
+	// ErrAuctionClosed when the auction has ended, and ErrBidTooLow when
+	// amount is below the minimum bid.
+	PlaceBid(ctx context.Context, auctionID int64, bidderID int64, amount int64, extendTo string) (domain.Bid, domain.Bid, error)
+	// CloseAuction closes an ended auction. The highest bid pays an order of
+	// the item like a purchase and is returned; without bids, the item goes
+	// back to a draft and the returned bid is empty. It returns
+	// ErrAuctionNotEnded when the auction is not open or has not ended.
+	CloseAuction(ctx context.Context, auctionID int64) (domain.Bid, int64, error)
+}
+
+type TradeDBRepository struct {
+	*DB
+}
+
+func NewTradeRepository(db *DB) TradeRepository {
+	return &TradeDBRepository{DB: db}
+}
+
+var (
+	ErrItemNotOnSale       = errors.New("item is not on sale")
+	ErrInsufficientBalance = errors.New("balance is not enough")
+	ErrInvalidOrderStatus  = errors.New("invalid order status")
+	ErrItemReserved        = errors.New("item is reserved for another buyer")
+)
+
+func (r *TradeDBRepository) TopUp(ctx context.Context, userID int64, amount int64) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		return addBalance(ctx, tx, domain.LedgerEntry{UserID: userID, Type: domain.LedgerTypeTopUp, Amount: amount})
+	})
+}
+
+func (r *TradeDBRepository) Purchase(ctx context.Context, buyerID int64, itemID int32) (int64, error) {
+	var orderID int64
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		// holds, offers and edits of the item wait until the purchase is done
+		if err := lockItem(ctx, tx, itemID); err != nil {
+			return err
+		}
+		var price, sellerID int64
+		row := tx.QueryRowContext(ctx, "SELECT price, seller_id FROM items WHERE id = ?", itemID)
+		if err := row.Scan(&price, &sellerID); err != nil {
+			return err
+		}
+		if err := checkNotAuctioned(ctx, tx, itemID); err != nil {
+			return err
+		}
+		// only the buyer holding a reserved item can buy it
+		from := domain.ItemStatusOnSale
+		reservation, err := activeReservation(ctx, tx, itemID)
+		switch {
+		case err == ErrReservationNotFound:
+		case err != nil:
+			return err
+		case reservation.ExpiresAt <= now():
+			// the sweeper has not released it yet
+			if err := releaseReservation(ctx, tx, reservation.ID, domain.ReservationStatusExpired); err != nil {
+				return err
+			}
+		case reservation.BuyerID != buyerID:
+			return ErrItemReserved
+		default:
+			price, from = reservation.Price, domain.ItemStatusReserved
+			if err := endReservation(ctx, tx, reservation); err != nil {
+				return err
+			}
+		}
+
+		if err := moveItemFrom(ctx, tx, itemID, from, domain.ItemStatusSoldOut, domain.ItemActorBuyer, buyerID, ErrItemNotOnSale); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE items SET buyer_id = ? WHERE id = ?", buyerID, itemID); err != nil {
+			return err
+		}
+		// the offers still being negotiated can not be accepted anymore
+		_, err = tx.ExecContext(ctx, "UPDATE offers SET status = ?, updated_at = ? WHERE item_id = ? AND status IN (?, ?)",
+			domain.OfferStatusRejected, now(), itemID, domain.OfferStatusPending, domain.OfferStatusCountered)
+		if err != nil {
+			return err
+		}
+
+		if err := addBalance(ctx, tx, domain.LedgerEntry{UserID: buyerID, Type: domain.LedgerTypePurchase, Amount: -price, CounterpartyID: sellerID, ItemID: itemID}); err != nil {
+			return err
+		}
+		orderID, err = insertID(ctx, tx, r.Dialect, "INSERT INTO orders (item_id, buyer_id, seller_id, price, status) VALUES (?, ?, ?, ?, ?)",
+			itemID, buyerID, sellerID, price, domain.OrderStatusPaid)
+		return err
+	})
+	return orderID, err
+}
+
+// endReservation marks a reservation and the offer it comes from as
+// purchased.
+func endReservation(ctx context.Context, tx *Tx, r domain.Reservation) error {
+	rst, err := tx.ExecContext(ctx, "UPDATE reservations SET status = ?, updated_at = ? WHERE id = ? AND status = ?",
+		domain.ReservationStatusPurchased, now(), r.ID, domain.ReservationStatusActive)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(rst, ErrReservationNotActive); err != nil {
+		return err
+	}
+	if r.OfferID == 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE offers SET status = ?, updated_at = ? WHERE id = ?", domain.OfferStatusPurchased, now(), r.OfferID)
+	return err
+}
+
+func (r *TradeDBRepository) AdvanceOrder(ctx context.Context, orderID int64, t domain.OrderTransition) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		set, args := "status = ?, updated_at = ?", []any{t.To, now()}
+		if t.To == domain.OrderStatusShipped {
+			set, args = set+", shipped_at = ?", append(args, now())
+		}
+		rst, err := tx.ExecContext(ctx, "UPDATE orders SET "+set+" WHERE id = ? AND status = ?", append(args, orderID, t.From)...)
+		if err != nil {
+			return err
+		}
+		if err := expectOneRow(rst, ErrInvalidOrderStatus); err != nil {
+			return err
+		}
+		if t.To != domain.OrderStatusReceived {
+			return nil
+		}
+
+		order, err := getOrder(ctx, tx, orderID)
+		if err != nil {
+			return err
+		}
+		return addBalance(ctx, tx, domain.LedgerEntry{UserID: order.SellerID, Type: domain.LedgerTypeSale, Amount: order.Price, CounterpartyID: order.BuyerID, ItemID: order.ItemID})
+	})
+}
+
+func (r *TradeDBRepository) ApproveCancellation(ctx context.Context, cancellationID int64, approverID int64) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		rst, err := tx.ExecContext(ctx, "UPDATE cancellations SET status = ?, updated_at = ? WHERE id = ? AND status = ?",
+			domain.CancellationStatusApproved, now(), cancellationID, domain.CancellationStatusRequested)
+		if err != nil {
+			return err
+		}
+		if err := expectOneRow(rst, ErrCancellationNotRequested); err != nil {
+			return err
+		}
+
+		var orderID int64
+		if err := tx.QueryRowContext(ctx, "SELECT order_id FROM cancellations WHERE id = ?", cancellationID).Scan(&orderID); err != nil {
+			return err
+		}
+		order, err := getOrder(ctx, tx, orderID)
+		if err != nil {
+			return err
+		}
+		return refundOrder(ctx, tx, order, domain.ItemActor(order.Role(approverID)), approverID)
+	})
+}
+
+func (r *TradeDBRepository) ForceRefund(ctx context.Context, orderID int64, adminID int64, reason string) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		rst, err := tx.ExecContext(ctx, "UPDATE cancellations SET status = ?, updated_at = ? WHERE order_id = ? AND status = ?",
+			domain.CancellationStatusForced, now(), orderID, domain.CancellationStatusRequested)
+		if err != nil {
+			return err
+		}
+		n, err := rst.RowsAffected()
+		if err != nil {
+			return err
+		}
+		// nobody had requested it, so the admin does
+		if n == 0 {
+			_, err := tx.ExecContext(ctx, "INSERT INTO cancellations (order_id, requested_by, reason, status) VALUES (?, ?, ?, ?)",
+				orderID, adminID, reason, domain.CancellationStatusForced)
+			if err != nil {
+				return err
+			}
+		}
+		order, err := getOrder(ctx, tx, orderID)
+		if err != nil {
+			return err
+		}
+		return refundOrder(ctx, tx, order, domain.ItemActorAdmin, adminID)
+	})
+}
+
+func (r *TradeDBRepository) PlaceBid(ctx context.Context, auctionID int64, bidderID int64, amount int64, extendTo string) (domain.Bid, domain.Bid, error) {
+	bid := domain.Bid{AuctionID: auctionID, BidderID: bidderID, Amount: amount, Status: domain.BidStatusHeld}
+	var outbid domain.Bid
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		// locks the auction, so that concurrent bids are placed one after
+		// the other and each sees the one before
+		rst, err := tx.ExecContext(ctx, "UPDATE auctions SET updated_at = ? WHERE id = ? AND status = ?", now(), auctionID, domain.AuctionStatusOpen)
+		if err != nil {
+			return err
+		}
+		if err := expectOneRow(rst, ErrAuctionClosed); err != nil {
+			return err
+		}
+		a, err := getAuction(ctx, tx, "id = ?", auctionID)
+		if err != nil {
+			return err
+		}
+		if a.EndsAt <= now() {
+			return ErrAuctionClosed
+		}
+		if amount < a.MinBid() {
+			return ErrBidTooLow
+		}
+		bid.ItemID = a.ItemID
+
+		if a.HighestBidderID != 0 {
+			if outbid, err = highestBid(ctx, tx, auctionID); err != nil {
+				return err
+			}
+			rst, err := tx.ExecContext(ctx, "UPDATE bids SET status = ?, updated_at = ? WHERE id = ? AND status = ?", domain.BidStatusReleased, now(), outbid.ID, domain.BidStatusHeld)
+			if err != nil {
+				return err
+			}
+			// another bid has outbid it in the meantime
+			if err := expectOneRow(rst, ErrBidTooLow); err != nil {
+				return err
+			}
+			err = addBalance(ctx, tx, domain.LedgerEntry{UserID: outbid.BidderID, Type: domain.LedgerTypeBidRelease, Amount: outbid.Amount, CounterpartyID: a.SellerID, ItemID: a.ItemID})
+			if err != nil {
+				return err
+			}
+			outbid.ItemID, outbid.Status = a.ItemID, domain.BidStatusReleased
+		}
+
+		if err := addBalance(ctx, tx, domain.LedgerEntry{UserID: bidderID, Type: domain.LedgerTypeBid, Amount: -amount, CounterpartyID: a.SellerID, ItemID: a.ItemID}); err != nil {
+			return err
+		}
+		bid.ID, err = insertID(ctx, tx, r.Dialect, "INSERT INTO bids (auction_id, bidder_id, amount, status) VALUES (?, ?, ?, ?)", auctionID, bidderID, amount, domain.BidStatusHeld)
+		if err != nil {
+			return err
+		}
+		// a bid close to the end gives the others time to answer
+		if _, err := tx.ExecContext(ctx, "UPDATE auctions SET ends_at = ?, updated_at = ? WHERE id = ? AND ends_at < ?", extendTo, now(), auctionID, extendTo); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE items SET price = ?, updated_at = ? WHERE id = ?", amount, now(), a.ItemID)
+		return err
+	})
+	if err != nil {
+		return domain.Bid{}, domain.Bid{}, err
+	}
+	return bid, outbid, nil
+}
+
+func (r *TradeDBRepository) CloseAuction(ctx context.Context, auctionID int64) (domain.Bid, int64, error) {
+	var winner domain.Bid
+	var orderID int64
+	err := withTx(ctx, r.DB, func(tx *Tx) error {
+		rst, err := tx.ExecContext(ctx, "UPDATE auctions SET status = ?, updated_at = ? WHERE id = ? AND status = ? AND ends_at <= ?",
+			domain.AuctionStatusClosed, now(), auctionID, domain.AuctionStatusOpen, now())
+		if err != nil {
+			return err
+		}
+		if err := expectOneRow(rst, ErrAuctionNotEnded); err != nil {
+			return err
+		}
+		a, err := getAuction(ctx, tx, "id = ?", auctionID)
+		if err != nil {
+			return err
+		}
+
+		winner, err = highestBid(ctx, tx, auctionID)
+		if err == sql.ErrNoRows {
+			return moveItem(ctx, tx, a.ItemID, domain.ItemStatusInitial, domain.ItemActorSystem, 0, ErrItemNotOnSale)
+		}
+		if err != nil {
+			return err
+		}
+		winner.ItemID, winner.Status = a.ItemID, domain.BidStatusWon
+
+		if _, err := tx.ExecContext(ctx, "UPDATE bids SET status = ?, updated_at = ? WHERE id = ?", domain.BidStatusWon, now(), winner.ID); err != nil {
+			return err
+		}
+		if err := releaseHeldBids(ctx, tx, a); err != nil {
+			return err
+		}
+		// the held amount pays the order
+		err = addBalance(ctx, tx, domain.LedgerEntry{UserID: winner.BidderID, Type: domain.LedgerTypeBidRelease, Amount: winner.Amount, CounterpartyID: a.SellerID, ItemID: a.ItemID})
+		if err != nil {
+			return err
+		}
+		err = addBalance(ctx, tx, domain.LedgerEntry{UserID: winner.BidderID, Type: domain.LedgerTypePurchase, Amount: -winner.Amount, CounterpartyID: a.SellerID, ItemID: a.ItemID})
+		if err != nil {
+			return err
+		}
+		if err := moveItem(ctx, tx, a.ItemID, domain.ItemStatusSoldOut, domain.ItemActorSystem, 0, ErrItemNotOnSale); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE items SET buyer_id = ?, price = ? WHERE id = ?", winner.BidderID, winner.Amount, a.ItemID); err != nil {
+			return err
+		}
+		orderID, err = insertID(ctx, tx, r.Dialect, "INSERT INTO orders (item_id, buyer_id, seller_id, price, status) VALUES (?, ?, ?, ?, ?)",
+			a.ItemID, winner.BidderID, a.SellerID, winner.Amount, domain.OrderStatusPaid)
+		return err
+	})
+	if err != nil {
+		return domain.Bid{}, 0, err
+	}
+	return winner, orderID, nil
+}
+
+// releaseHeldBids gives back every bid of the auction a that is still held,
+// which only the winning bid should be once it is marked as won.
+func releaseHeldBids(ctx context.Context, tx *Tx, a domain.Auction) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, bidder_id, amount FROM bids WHERE auction_id = ? AND status = ?", a.ID, domain.BidStatusHeld)
+	if err != nil {
+		return err
+	}
+	var held []domain.Bid
+	for rows.Next() {
+		var b domain.Bid
+		if err := rows.Scan(&b.ID, &b.BidderID, &b.Amount); err != nil {
+			rows.Close()
+			return err
+		}
+		held = append(held, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, b := range held {
+		if _, err := tx.ExecContext(ctx, "UPDATE bids SET status = ?, updated_at = ? WHERE id = ?", domain.BidStatusReleased, now(), b.ID); err != nil {
+			return err
+		}
+		err := addBalance(ctx, tx, domain.LedgerEntry{UserID: b.BidderID, Type: domain.LedgerTypeBidRelease, Amount: b.Amount, CounterpartyID: a.SellerID, ItemID: a.ItemID})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TradeDBRepository) CancelUnshipped(ctx context.Context, orderID int64) error {
+	return withTx(ctx, r.DB, func(tx *Tx) error {
+		order, err := getOrder(ctx, tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != domain.OrderStatusPaid {
+			return ErrInvalidOrderStatus
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE cancellations SET status = ?, updated_at = ? WHERE order_id = ? AND status = ?",
+			domain.CancellationStatusApproved, now(), orderID, domain.CancellationStatusRequested)
+		if err != nil {
+			return err
+		}
+		return refundOrder(ctx, tx, order, domain.ItemActorSystem, 0)
+	})
+}
+
+// refundOrder cancels an order whose money is still held, refunds the buyer
+// and returns the item to the seller, on behalf of the actor userID.
+func refundOrder(ctx context.Context, tx *Tx, order domain.Order, actor domain.ItemActor, userID int64) error {
+	if !order.Status.Held() {
+		return ErrInvalidOrderStatus
+	}
+	rst, err := tx.ExecContext(ctx, "UPDATE orders SET status = ?, updated_at = ? WHERE id = ? AND status = ?", domain.OrderStatusCancelled, now(), order.ID, order.Status)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(rst, ErrInvalidOrderStatus); err != nil {
+		return err
+	}
+
+	if err := returnItem(ctx, tx, order.ItemID, order.CancelledItemStatus(), actor, userID, ErrInvalidItemStatus); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE items SET buyer_id = NULL WHERE id = ?", order.ItemID); err != nil {
+		return err
+	}
+	return addBalance(ctx, tx, domain.LedgerEntry{UserID: order.BuyerID, Type: domain.LedgerTypeRefund, Amount: order.Price, CounterpartyID: order.SellerID, ItemID: order.ItemID})
+}
+
+// addBalance applies entry.Amount to the user's balance and appends the entry
+// to the ledger. A debit that would make the balance negative fails with
+// ErrInsufficientBalance.
+func addBalance(ctx context.Context, tx *Tx, entry domain.LedgerEntry) error {
+	rst, err := tx.ExecContext(ctx, "UPDATE users SET balance = balance + ? WHERE id = ? AND balance + ? >= 0", entry.Amount, entry.UserID, entry.Amount)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(rst, ErrInsufficientBalance); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO ledger (user_id, type, amount, counterparty_id, item_id) VALUES (?, ?, ?, ?, ?)",
+		entry.UserID, entry.Type, entry.Amount, nullInt64(entry.CounterpartyID), nullInt64(int64(entry.ItemID)))
+	return err
+}
+
+func withTx(ctx context.Context, db *DB, fn func(tx *Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func expectOneRow(rst sql.Result, errNoRow error) error {
+	n, err := rst.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNoRow
+	}
+	return nil
+}
+
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
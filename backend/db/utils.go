@@ -3,7 +3,6 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"io"
 	"log"
@@ -15,7 +14,9 @@ import (
 	"github.com/pkg/errors"
 )
 
-func Initialize(ctx context.Context, db *sql.DB) error {
+// Initialize resets the schema by reverting and re-applying every migration,
+// then loads the seed data in sql/.
+func Initialize(ctx context.Context, db *DB) error {
 	root, err := os.Getwd()
 	if err != nil {
 		return err
@@ -26,6 +27,20 @@ func Initialize(ctx context.Context, db *sql.DB) error {
 		return err
 	}
 
+	mdb, err := db.forMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if mdb != db {
+		defer mdb.Close()
+	}
+	if _, err := MigrateDown(ctx, mdb, -1); err != nil {
+		return err
+	}
+	if _, err := MigrateUp(ctx, mdb); err != nil {
+		return err
+	}
+
 	pattern := filepath.Join(root, "sql", "*.sql")
 	paths, err := filepath.Glob(pattern)
 	if err != nil {
@@ -41,12 +56,16 @@ func Initialize(ctx context.Context, db *sql.DB) error {
 			return errors.Wrap(err, fmt.Sprintf("Failed to load sql: %s", path))
 		}
 
-		if _, err = db.ExecContext(ctx, string(f)); err != nil {
+		if _, err = mdb.ExecContext(ctx, string(f)); err != nil {
 			return errors.Wrap(err, fmt.Sprintf("Failed to exec sql: %s", path))
 		}
 	}
 
-	return nil
+	if err := BackfillOpeningBalances(ctx, db); err != nil {
+		return err
+	}
+	_, err = IndexItems(ctx, db)
+	return err
 }
 
 func putDataSql() error {
@@ -55,6 +74,10 @@ func putDataSql() error {
 		return err
 	}
 
+	if err := os.MkdirAll(filepath.Join(root, "sql"), 0755); err != nil {
+		return err
+	}
+
 	dpath := filepath.Join(root, "sql", "10_data.sql")
 	_, err = os.Stat(dpath)
 	if os.IsNotExist(err) {
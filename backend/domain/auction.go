@@ -0,0 +1,64 @@
+package domain
+
+import "time"
+
+// MaxAuctionDuration is how long after it starts an auction can end.
+const MaxAuctionDuration = 14 * 24 * time.Hour
+
+type AuctionStatus string
+
+const (
+	AuctionStatusOpen AuctionStatus = "open"
+	// AuctionStatusClosed is an ended auction. The item has been sold to
+	// the highest bidder, or returned to a draft when nobody bid.
+	AuctionStatusClosed AuctionStatus = "closed"
+)
+
+// Auction sells an item on sale to the highest bidder at EndsAt. The first bid
+// has to be at least StartPrice, and each next one MinIncrement more than the
+// highest. HighestBid and HighestBidderID are 0 until someone bids, and are
+// only filled when reading auctions.
+type Auction struct {
+	ID              int64
+	ItemID          int32
+	SellerID        int64
+	StartPrice      int64
+	MinIncrement    int64
+	EndsAt          string
+	Status          AuctionStatus
+	HighestBid      int64
+	HighestBidderID int64
+	BidCount        int64
+	CreatedAt       string
+}
+
+// MinBid returns the lowest amount the next bid can have.
+func (a Auction) MinBid() int64 {
+	if a.HighestBidderID == 0 {
+		return a.StartPrice
+	}
+	return a.HighestBid + a.MinIncrement
+}
+
+type BidStatus string
+
+const (
+	// BidStatusHeld is the highest bid, whose amount is held from the
+	// balance of the bidder.
+	BidStatusHeld BidStatus = "held"
+	// BidStatusReleased is an outbid bid, whose amount has been given back.
+	BidStatusReleased BidStatus = "released"
+	// BidStatusWon is the highest bid when the auction ended, which has paid
+	// the order of the item.
+	BidStatusWon BidStatus = "won"
+)
+
+type Bid struct {
+	ID        int64
+	AuctionID int64
+	ItemID    int32
+	BidderID  int64
+	Amount    int64
+	Status    BidStatus
+	CreatedAt string
+}
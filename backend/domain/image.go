@@ -0,0 +1,17 @@
+package domain
+
+// MaxItemImages is the number of images a seller can attach to one item.
+const MaxItemImages = 10
+
+// ItemImage is one image of an item. ThumbnailKey and MediumKey point to the
+// scaled down renditions and are empty until they have been rendered.
+type ItemImage struct {
+	ID           int64
+	ItemID       int32
+	ImageKey     string
+	ThumbnailKey string
+	MediumKey    string
+	Position     int
+	IsCover      bool
+	CreatedAt    string
+}
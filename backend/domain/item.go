@@ -2,12 +2,29 @@ package domain
 
 type ItemStatus int
 
+// The statuses of an item. They are stored as numbers, so new ones are only
+// ever appended. ItemTransitions lists how an item moves between them.
 const (
+	// ItemStatusInitial is a draft, which only its seller can see.
 	ItemStatusInitial ItemStatus = iota + 1
 	ItemStatusOnSale
 	ItemStatusSoldOut
+	// ItemStatusReserved is on sale but held for one buyer, who alone can
+	// purchase it until the hold expires.
+	ItemStatusReserved
+	// ItemStatusPaused is on sale but hidden from listings and searches
+	// until its seller unpauses it.
+	ItemStatusPaused
+	// ItemStatusDeleted is removed by its seller. It is kept with its
+	// history, but nobody else can see it anymore.
+	ItemStatusDeleted
 )
 
+// TimestampLayout is the format of CreatedAt and UpdatedAt, in the local time
+// of the server.
+const TimestampLayout = "2006-01-02 15:04:05"
+
+// Item is listed by the user UserID. BuyerID is 0 until it is purchased.
 type Item struct {
 	ID          int32
 	Name        string
@@ -15,15 +32,31 @@ type Item struct {
 	Description string
 	CategoryID  int64
 	UserID      int64
-	Image       []byte
+	BuyerID     int64
 	Status      ItemStatus
 	CreatedAt   string
 	UpdatedAt   string
 }
 
+// ItemSort is the order of item listings.
+type ItemSort string
+
+const (
+	ItemSortNewest    ItemSort = "newest"
+	ItemSortPriceAsc  ItemSort = "price_asc"
+	ItemSortPriceDesc ItemSort = "price_desc"
+	ItemSortUpdated   ItemSort = "updated"
+	// ItemSortRelevance is only available to searches.
+	ItemSortRelevance ItemSort = "relevance"
+)
+
 type ItemWithCategory struct {
-	Item     Item
-	Category Category
+	Item      Item
+	Category  Category
+	LikeCount int64
+	// Snippet is a highlighted excerpt of the item when it was found by a
+	// search.
+	Snippet string
 }
 
 type Category struct {
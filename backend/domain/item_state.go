@@ -0,0 +1,134 @@
+package domain
+
+// ItemActor is who changes the status of an item.
+type ItemActor string
+
+const (
+	ItemActorSeller ItemActor = "seller"
+	ItemActorBuyer  ItemActor = "buyer"
+	ItemActorAdmin  ItemActor = "admin"
+	// ItemActorSystem is the server itself, like when a hold expires or an
+	// auction ends.
+	ItemActorSystem ItemActor = "system"
+)
+
+// ItemTransition moves an item from the status From to the status To. Only
+// the actors By can make it.
+type ItemTransition struct {
+	From ItemStatus
+	To   ItemStatus
+	By   []ItemActor
+}
+
+// Allows reports whether the actor can make the transition.
+func (t ItemTransition) Allows(actor ItemActor) bool {
+	for _, by := range t.By {
+		if by == actor {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemTransitions are the changes of status the actors can make on an item.
+// Sold items only leave SoldOut through ReturnedItemTransitions.
+var ItemTransitions = []ItemTransition{
+	// listed at a fixed price or by auction
+	{From: ItemStatusInitial, To: ItemStatusOnSale, By: []ItemActor{ItemActorSeller}},
+	// unlisted by the seller, or an auction ended without bids
+	{From: ItemStatusOnSale, To: ItemStatusInitial, By: []ItemActor{ItemActorSeller, ItemActorSystem}},
+	{From: ItemStatusOnSale, To: ItemStatusPaused, By: []ItemActor{ItemActorSeller}},
+	{From: ItemStatusPaused, To: ItemStatusOnSale, By: []ItemActor{ItemActorSeller}},
+	{From: ItemStatusPaused, To: ItemStatusInitial, By: []ItemActor{ItemActorSeller}},
+	// held by a buyer, or by the party who accepted an offer
+	{From: ItemStatusOnSale, To: ItemStatusReserved, By: []ItemActor{ItemActorBuyer, ItemActorSeller}},
+	// given up by the buyer, or expired
+	{From: ItemStatusReserved, To: ItemStatusOnSale, By: []ItemActor{ItemActorBuyer, ItemActorSystem}},
+	// purchased, or won at the end of an auction
+	{From: ItemStatusOnSale, To: ItemStatusSoldOut, By: []ItemActor{ItemActorBuyer, ItemActorSystem}},
+	{From: ItemStatusReserved, To: ItemStatusSoldOut, By: []ItemActor{ItemActorBuyer}},
+	{From: ItemStatusInitial, To: ItemStatusDeleted, By: []ItemActor{ItemActorSeller}},
+	{From: ItemStatusOnSale, To: ItemStatusDeleted, By: []ItemActor{ItemActorSeller}},
+	{From: ItemStatusPaused, To: ItemStatusDeleted, By: []ItemActor{ItemActorSeller}},
+}
+
+// ReturnedItemTransitions are the changes of status of a sold item whose
+// order is cancelled, by the party approving the cancellation, an admin
+// forcing a refund, or the system when the order is not shipped in time.
+// Only the cancellation of the order makes them; see
+// Order.CancelledItemStatus.
+var ReturnedItemTransitions = []ItemTransition{
+	{From: ItemStatusSoldOut, To: ItemStatusOnSale, By: []ItemActor{ItemActorBuyer, ItemActorSeller, ItemActorAdmin, ItemActorSystem}},
+	{From: ItemStatusSoldOut, To: ItemStatusInitial, By: []ItemActor{ItemActorBuyer, ItemActorSeller, ItemActorAdmin}},
+}
+
+// FindItemTransition returns the transition of transitions from the status
+// from to the status to, and false when an item can not move that way.
+func FindItemTransition(transitions []ItemTransition, from, to ItemStatus) (ItemTransition, bool) {
+	for _, t := range transitions {
+		if t.From == from && t.To == to {
+			return t, true
+		}
+	}
+	return ItemTransition{}, false
+}
+
+// CanMoveItem reports whether the actor can move an item from the status from
+// to the status to.
+func CanMoveItem(from, to ItemStatus, actor ItemActor) bool {
+	t, ok := FindItemTransition(ItemTransitions, from, to)
+	return ok && t.Allows(actor)
+}
+
+// CanReturnItem reports whether the actor can move a sold item from the
+// status from to the status to when its order is cancelled.
+func CanReturnItem(from, to ItemStatus, actor ItemActor) bool {
+	t, ok := FindItemTransition(ReturnedItemTransitions, from, to)
+	return ok && t.Allows(actor)
+}
+
+// PublicItemStatuses are the statuses of the items anyone can find in
+// listings and searches.
+var PublicItemStatuses = []ItemStatus{ItemStatusOnSale, ItemStatusReserved, ItemStatusSoldOut}
+
+// Public reports whether anyone can find an item in the status.
+func (s ItemStatus) Public() bool {
+	for _, public := range PublicItemStatuses {
+		if s == public {
+			return true
+		}
+	}
+	return false
+}
+
+// ForSale reports whether an item in the status is listed and not sold yet.
+func (s ItemStatus) ForSale() bool {
+	return s == ItemStatusOnSale || s == ItemStatusReserved
+}
+
+// EditableItemStatuses are the statuses in which the seller can still change
+// an item. Held and sold items are what their buyers agreed to.
+var EditableItemStatuses = []ItemStatus{ItemStatusInitial, ItemStatusOnSale, ItemStatusPaused}
+
+// Editable reports whether the seller can still change an item in the
+// status.
+func (s ItemStatus) Editable() bool {
+	for _, editable := range EditableItemStatuses {
+		if s == editable {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemStatusChange is an entry of the history of an item. From is 0 for the
+// creation of the item, and UserID is 0 when the server made the change.
+type ItemStatusChange struct {
+	ID        int64
+	ItemID    int32
+	From      ItemStatus
+	To        ItemStatus
+	Actor     ItemActor
+	UserID    int64
+	CreatedAt string
+}
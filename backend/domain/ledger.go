@@ -0,0 +1,37 @@
+package domain
+
+type LedgerType string
+
+const (
+	// LedgerTypeOpening carries over balances that existed before the ledger.
+	LedgerTypeOpening  LedgerType = "opening"
+	LedgerTypeTopUp    LedgerType = "topup"
+	LedgerTypePurchase LedgerType = "purchase"
+	LedgerTypeSale     LedgerType = "sale"
+	LedgerTypeRefund   LedgerType = "refund"
+	// LedgerTypeBid holds the amount of a bid until the bidder is outbid or
+	// the auction ends.
+	LedgerTypeBid LedgerType = "bid"
+	// LedgerTypeBidRelease gives back the amount of a bid.
+	LedgerTypeBidRelease LedgerType = "bid_release"
+)
+
+// LedgerEntry is a single money movement on a user's balance.
+// Amount is signed: debits are negative and credits are positive.
+type LedgerEntry struct {
+	ID             int64
+	UserID         int64
+	Type           LedgerType
+	Amount         int64
+	CounterpartyID int64
+	ItemID         int32
+	CreatedAt      string
+}
+
+// BalanceMismatch is a user whose stored balance disagrees with the sum of
+// their ledger entries.
+type BalanceMismatch struct {
+	UserID        int64
+	Balance       int64
+	LedgerBalance int64
+}
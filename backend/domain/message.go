@@ -0,0 +1,22 @@
+package domain
+
+// MaxMessageLength is the number of characters a message can have.
+const MaxMessageLength = 1000
+
+// Message is a public comment on an item, or a private message between the
+// seller and the buyer of an order of the item, whose OrderID is set. An item
+// sold again after a cancellation has a private thread per order.
+// RecipientID is the user who has to read it, 0 for the answers of the
+// seller to public comments. SenderName is only filled when reading messages.
+type Message struct {
+	ID          int64
+	ItemID      int32
+	OrderID     int64
+	SenderID    int64
+	SenderName  string
+	RecipientID int64
+	Private     bool
+	Body        string
+	IsRead      bool
+	CreatedAt   string
+}
@@ -0,0 +1,96 @@
+package domain
+
+// MaxSavedSearches is the number of searches a user can save.
+const MaxSavedSearches = 20
+
+// SavedSearch is a search a user wants to be notified about when a matching
+// item is put on sale. Zero values do not filter, like in a search.
+type SavedSearch struct {
+	ID          int64
+	UserID      int64
+	Query       string
+	CategoryIDs []int64
+	MinPrice    int64
+	MaxPrice    int64
+	SellerID    int64
+	CreatedAt   string
+}
+
+type NotificationType string
+
+const (
+	// NotificationTypeSavedSearch tells that an item matching a saved search
+	// has been put on sale.
+	NotificationTypeSavedSearch NotificationType = "saved_search"
+	// NotificationTypePriceDrop tells the watchers of an item that its
+	// price has been lowered.
+	NotificationTypePriceDrop NotificationType = "price_drop"
+	// NotificationTypeItemSold tells the seller that their item has been
+	// purchased.
+	NotificationTypeItemSold NotificationType = "item_sold"
+	// NotificationTypeSold tells the watchers of an item that it has been
+	// sold.
+	NotificationTypeSold NotificationType = "sold"
+	// NotificationTypeMessage tells that someone has commented on the user's
+	// item or sent them a private message about an item.
+	NotificationTypeMessage NotificationType = "message"
+	// NotificationTypeOrderShipped tells the buyer that the seller has sent
+	// the item.
+	NotificationTypeOrderShipped NotificationType = "order_shipped"
+	// NotificationTypeOrderReceived tells the seller that the buyer has
+	// received the item, and that the money has been released to them.
+	NotificationTypeOrderReceived NotificationType = "order_received"
+	// NotificationTypeOrderCompleted tells the buyer that the seller has
+	// closed the order.
+	NotificationTypeOrderCompleted NotificationType = "order_completed"
+	// NotificationTypeCancelRequested asks a party of an order to approve its
+	// cancellation.
+	NotificationTypeCancelRequested NotificationType = "cancel_requested"
+	// NotificationTypeCancelRejected tells the party who requested the
+	// cancellation of an order that the other party has rejected it.
+	NotificationTypeCancelRejected NotificationType = "cancel_rejected"
+	// NotificationTypeOrderCancelled tells that an order has been cancelled
+	// and the buyer refunded.
+	NotificationTypeOrderCancelled NotificationType = "order_cancelled"
+	// NotificationTypeReviewed tells a user that the other party of an order
+	// has reviewed them.
+	NotificationTypeReviewed NotificationType = "reviewed"
+	// NotificationTypeOffer asks a user to answer an offer, or the price
+	// the other party has proposed instead.
+	NotificationTypeOffer NotificationType = "offer"
+	// NotificationTypeOfferAccepted tells a user that the other party has
+	// agreed to the price of their offer.
+	NotificationTypeOfferAccepted NotificationType = "offer_accepted"
+	// NotificationTypeOfferRejected tells a user that the other party has
+	// ended the negotiation of an offer.
+	NotificationTypeOfferRejected NotificationType = "offer_rejected"
+	// NotificationTypeItemReserved tells the seller that a buyer holds
+	// their item.
+	NotificationTypeItemReserved NotificationType = "item_reserved"
+	// NotificationTypeReservationExpired tells a buyer that their hold on
+	// an item has run out, and the item is on sale again.
+	NotificationTypeReservationExpired NotificationType = "reservation_expired"
+	// NotificationTypeOutbid tells a bidder that a higher bid has been
+	// placed, and that their amount has been given back.
+	NotificationTypeOutbid NotificationType = "outbid"
+	// NotificationTypeAuctionWon tells the highest bidder of an ended
+	// auction that they have bought the item.
+	NotificationTypeAuctionWon NotificationType = "auction_won"
+	// NotificationTypeAuctionUnsold tells the seller that their auction
+	// ended without bids, and that the item is a draft again.
+	NotificationTypeAuctionUnsold NotificationType = "auction_unsold"
+)
+
+// Notification is an entry of a user's inbox about an item. SavedSearchID is
+// 0 unless the notification is about a saved search, and ItemName is only
+// filled when reading notifications.
+type Notification struct {
+	ID            int64
+	UserID        int64
+	Type          NotificationType
+	ItemID        int32
+	ItemName      string
+	SavedSearchID int64
+	IsRead        bool
+	CreatedAt     string
+}
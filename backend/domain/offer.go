@@ -0,0 +1,58 @@
+package domain
+
+type OfferStatus string
+
+const (
+	// OfferStatusPending is waiting for the seller to answer.
+	OfferStatusPending OfferStatus = "pending"
+	// OfferStatusCountered is waiting for the buyer to answer the price the
+	// seller has proposed instead.
+	OfferStatusCountered OfferStatus = "countered"
+	// OfferStatusAccepted reserves the item for the buyer at the price of
+	// the offer until ExpiresAt.
+	OfferStatusAccepted OfferStatus = "accepted"
+	OfferStatusRejected OfferStatus = "rejected"
+	// OfferStatusPurchased is an accepted offer the buyer has paid.
+	OfferStatusPurchased OfferStatus = "purchased"
+)
+
+// Awaiting returns the party who has to answer an offer in the status, or ""
+// when the negotiation is over.
+func (s OfferStatus) Awaiting() OrderRole {
+	switch s {
+	case OfferStatusPending:
+		return OrderRoleSeller
+	case OfferStatusCountered:
+		return OrderRoleBuyer
+	}
+	return ""
+}
+
+// Offer is a price a buyer and the seller of an item on sale negotiate. Each
+// counter offer replaces Price and passes the turn to the other party.
+// ExpiresAt is only set once the offer is accepted, and ItemName is only
+// filled when reading offers.
+type Offer struct {
+	ID        int64
+	ItemID    int32
+	ItemName  string
+	BuyerID   int64
+	SellerID  int64
+	Price     int64
+	Status    OfferStatus
+	ExpiresAt string
+	CreatedAt string
+	UpdatedAt string
+}
+
+// Role returns the part the user takes in the offer, or "" when the user is
+// not a party to it.
+func (o Offer) Role(userID int64) OrderRole {
+	switch userID {
+	case o.BuyerID:
+		return OrderRoleBuyer
+	case o.SellerID:
+		return OrderRoleSeller
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package domain
+
+type OrderStatus string
+
+const (
+	// OrderStatusPaid is a new order. The buyer has paid, and the money is
+	// held until the buyer confirms receipt.
+	OrderStatusPaid OrderStatus = "paid"
+	// OrderStatusShipped is an order the seller has sent.
+	OrderStatusShipped OrderStatus = "shipped"
+	// OrderStatusReceived is an order the buyer has received. The money has
+	// been released to the seller.
+	OrderStatusReceived OrderStatus = "received"
+	// OrderStatusCompleted is an order the seller has closed.
+	OrderStatusCompleted OrderStatus = "completed"
+	// OrderStatusCancelled is an order called off before it was received.
+	// The money has been refunded to the buyer.
+	OrderStatusCancelled OrderStatus = "cancelled"
+)
+
+// HeldOrderStatuses are the statuses in which the money of an order is held
+// in escrow, and can still be refunded to the buyer.
+var HeldOrderStatuses = []OrderStatus{OrderStatusPaid, OrderStatusShipped}
+
+// Held reports whether the money of an order in the status is held.
+func (s OrderStatus) Held() bool {
+	for _, held := range HeldOrderStatuses {
+		if s == held {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderRole is the part a user takes in an order.
+type OrderRole string
+
+const (
+	OrderRoleBuyer  OrderRole = "buyer"
+	OrderRoleSeller OrderRole = "seller"
+	// OrderRoleSystem is the server itself, which no user can act as.
+	OrderRoleSystem OrderRole = "system"
+)
+
+// OrderTransition moves an order from the status From to the status To. Only
+// the party By can make it.
+type OrderTransition struct {
+	From OrderStatus
+	To   OrderStatus
+	By   OrderRole
+}
+
+// The transitions an order goes through, in order.
+var (
+	OrderShip     = OrderTransition{From: OrderStatusPaid, To: OrderStatusShipped, By: OrderRoleSeller}
+	OrderReceive  = OrderTransition{From: OrderStatusShipped, To: OrderStatusReceived, By: OrderRoleBuyer}
+	OrderComplete = OrderTransition{From: OrderStatusReceived, To: OrderStatusCompleted, By: OrderRoleSeller}
+	// OrderRelease receives a shipped order the buyer has not confirmed in
+	// time.
+	OrderRelease = OrderTransition{From: OrderStatusShipped, To: OrderStatusReceived, By: OrderRoleSystem}
+)
+
+// Order is the trade of an item between its seller and a buyer. Price is what
+// the buyer paid, CreatedAt is when they paid, ShippedAt is when the seller
+// shipped it or "", and UpdatedAt is when the order got its status. ItemName
+// is only filled when reading orders.
+type Order struct {
+	ID        int64
+	ItemID    int32
+	ItemName  string
+	BuyerID   int64
+	SellerID  int64
+	Price     int64
+	Status    OrderStatus
+	CreatedAt string
+	ShippedAt string
+	UpdatedAt string
+}
+
+// Role returns the part the user takes in the order, or "" when the user is
+// not a party to it.
+func (o Order) Role(userID int64) OrderRole {
+	switch userID {
+	case o.BuyerID:
+		return OrderRoleBuyer
+	case o.SellerID:
+		return OrderRoleSeller
+	}
+	return ""
+}
+
+// Reviewable reports whether the parties can review the order, which they can
+// once the buyer has received the item.
+func (o Order) Reviewable() bool {
+	return o.Status == OrderStatusReceived || o.Status == OrderStatusCompleted
+}
+
+// CancelledItemStatus is the status the item returns to when the order is
+// cancelled: on sale when it has not been shipped, and otherwise a draft, so
+// that the seller can check the returned item before selling it again.
+func (o Order) CancelledItemStatus() ItemStatus {
+	if o.Status == OrderStatusPaid {
+		return ItemStatusOnSale
+	}
+	return ItemStatusInitial
+}
+
+// MaxCancellationReason is the number of characters the reason of a
+// cancellation can have.
+const MaxCancellationReason = 255
+
+type CancellationStatus string
+
+const (
+	// CancellationStatusRequested is waiting for the other party.
+	CancellationStatusRequested CancellationStatus = "requested"
+	// CancellationStatusApproved has refunded the buyer.
+	CancellationStatusApproved CancellationStatus = "approved"
+	// CancellationStatusRejected has left the order as it was.
+	CancellationStatusRejected CancellationStatus = "rejected"
+	// CancellationStatusForced is a refund made by an admin, who is
+	// RequestedBy unless a party had requested it before.
+	CancellationStatusForced CancellationStatus = "forced"
+)
+
+// Cancellation is a request of a party to call off an order, which the other
+// party approves or rejects. An order has at most one requested
+// cancellation at a time.
+type Cancellation struct {
+	ID          int64
+	OrderID     int64
+	RequestedBy int64
+	Reason      string
+	Status      CancellationStatus
+	CreatedAt   string
+	UpdatedAt   string
+}
@@ -0,0 +1,32 @@
+package domain
+
+type ReservationStatus string
+
+const (
+	// ReservationStatusActive holds the item for the buyer until ExpiresAt.
+	ReservationStatusActive ReservationStatus = "active"
+	// ReservationStatusPurchased is a hold the buyer has paid.
+	ReservationStatusPurchased ReservationStatus = "purchased"
+	// ReservationStatusExpired is a hold that ran out, which put the item
+	// back on sale.
+	ReservationStatusExpired ReservationStatus = "expired"
+	// ReservationStatusReleased is a hold the buyer gave up before it
+	// expired.
+	ReservationStatusReleased ReservationStatus = "released"
+)
+
+// Reservation holds an item for one buyer, who can purchase it at Price until
+// ExpiresAt. Price is the listed price, or the price of the offer OfferID when
+// the reservation comes from an accepted offer. An item has at most one
+// active reservation at a time.
+type Reservation struct {
+	ID        int64
+	ItemID    int32
+	BuyerID   int64
+	Price     int64
+	OfferID   int64
+	Status    ReservationStatus
+	ExpiresAt string
+	CreatedAt string
+	UpdatedAt string
+}
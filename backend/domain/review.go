@@ -0,0 +1,45 @@
+package domain
+
+type Rating string
+
+const (
+	RatingGood   Rating = "good"
+	RatingNormal Rating = "normal"
+	RatingBad    Rating = "bad"
+)
+
+func (r Rating) Valid() bool {
+	switch r {
+	case RatingGood, RatingNormal, RatingBad:
+		return true
+	}
+	return false
+}
+
+// MaxReviewComment is the number of characters the comment of a review can
+// have.
+const MaxReviewComment = 1000
+
+// Review is what a party of an order thinks of the other party, RevieweeID.
+// Each party reviews an order once. ItemID, ItemName, ReviewerName and
+// ReviewerRole are only filled when reading reviews.
+type Review struct {
+	ID           int64
+	OrderID      int64
+	ItemID       int32
+	ItemName     string
+	ReviewerID   int64
+	ReviewerName string
+	ReviewerRole OrderRole
+	RevieweeID   int64
+	Rating       Rating
+	Comment      string
+	CreatedAt    string
+}
+
+// RatingSummary counts the ratings a user has received.
+type RatingSummary struct {
+	Good   int64
+	Normal int64
+	Bad    int64
+}
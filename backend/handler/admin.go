@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminOnly lets only admins through to the routes of a group.
+func (h *Handler) AdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := GetUserID(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+		}
+		admin, err := h.UserRepo.IsAdmin(c.Request().Context(), userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if !admin {
+			return echo.NewHTTPError(http.StatusForbidden, "only admins can do this")
+		}
+		return next(c)
+	}
+}
+
+// ForceRefund cancels an order and refunds the buyer without the approval of
+// the parties, who are both notified.
+func (h *Handler) ForceRefund(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	orderID, err := strconv.ParseInt(c.Param("orderID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid orderID type")
+	}
+	reason, err := getCancellationReason(c)
+	if err != nil {
+		return err
+	}
+
+	order, err := h.OrderService.ForceRefund(c.Request().Context(), userID, orderID, reason)
+	if err != nil {
+		return orderError(err)
+	}
+	h.notifyCancelled(c, order, 0)
+	return c.JSON(http.StatusOK, "successful")
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/service"
+	"github.com/labstack/echo/v4"
+)
+
+type startAuctionRequest struct {
+	StartPrice   int64 `json:"start_price"`
+	MinIncrement int64 `json:"min_increment"`
+	// EndsAt is in domain.TimestampLayout, in the local time of the server.
+	EndsAt string `json:"ends_at"`
+}
+
+type auctionResponse struct {
+	ID              int64                `json:"id"`
+	ItemID          int32                `json:"item_id"`
+	SellerID        int64                `json:"seller_id"`
+	StartPrice      int64                `json:"start_price"`
+	MinIncrement    int64                `json:"min_increment"`
+	EndsAt          string               `json:"ends_at"`
+	Status          domain.AuctionStatus `json:"status"`
+	HighestBid      int64                `json:"highest_bid"`
+	HighestBidderID int64                `json:"highest_bidder_id"`
+	BidCount        int64                `json:"bid_count"`
+	MinBid          int64                `json:"min_bid"`
+	CreatedAt       string               `json:"created_at"`
+}
+
+type bidRequest struct {
+	Amount int64 `json:"amount"`
+}
+
+type bidResponse struct {
+	ID        int64            `json:"id"`
+	BidderID  int64            `json:"bidder_id"`
+	Amount    int64            `json:"amount"`
+	Status    domain.BidStatus `json:"status"`
+	CreatedAt string           `json:"created_at"`
+}
+
+type addBidResponse struct {
+	ID int64 `json:"id"`
+}
+
+func auctionError(err error) error {
+	switch err {
+	case service.ErrItemNotFound, db.ErrAuctionNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case service.ErrNotItemSeller, service.ErrOwnItem, db.ErrInvalidItemStatus, db.ErrAuctionClosed, db.ErrBidTooLow, db.ErrInsufficientBalance:
+		return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
+	case service.ErrInvalidEndTime:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// getAuctionItemID reads the itemID parameter.
+func getAuctionItemID(c echo.Context) (int32, error) {
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+	return int32(itemID), nil
+}
+
+// StartAuction puts a draft item on sale by auction instead of at a fixed
+// price. The item is sold to the highest bidder when the auction ends.
+func (h *Handler) StartAuction(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	itemID, err := getAuctionItemID(c)
+	if err != nil {
+		return err
+	}
+	req := new(startAuctionRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.StartPrice <= 0 || req.MinIncrement <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "start_price and min_increment must be greater than 0")
+	}
+
+	item, err := h.AuctionService.Start(c.Request().Context(), userID, itemID, req.StartPrice, req.MinIncrement, req.EndsAt)
+	if err != nil {
+		return auctionError(err)
+	}
+	h.notifyListed(c, item)
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// GetAuction shows the latest auction of an item, with the lowest amount the
+// next bid can have.
+func (h *Handler) GetAuction(c echo.Context) error {
+	item, err := h.getPublicItem(c)
+	if err != nil {
+		return err
+	}
+	a, err := h.AuctionRepo.GetAuction(c.Request().Context(), item.ID)
+	if err != nil {
+		return auctionError(err)
+	}
+	return c.JSON(http.StatusOK, auctionResponse{
+		ID:              a.ID,
+		ItemID:          a.ItemID,
+		SellerID:        a.SellerID,
+		StartPrice:      a.StartPrice,
+		MinIncrement:    a.MinIncrement,
+		EndsAt:          a.EndsAt,
+		Status:          a.Status,
+		HighestBid:      a.HighestBid,
+		HighestBidderID: a.HighestBidderID,
+		BidCount:        a.BidCount,
+		MinBid:          a.MinBid(),
+		CreatedAt:       a.CreatedAt,
+	})
+}
+
+// GetBids lists the bids of the latest auction of an item, highest first.
+func (h *Handler) GetBids(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	item, err := h.getPublicItem(c)
+	if err != nil {
+		return err
+	}
+	limit, offset, err := getPagination(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	a, err := h.AuctionRepo.GetAuction(ctx, item.ID)
+	if err != nil {
+		return auctionError(err)
+	}
+	bids, err := h.AuctionRepo.GetBids(ctx, a.ID, limit, offset)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	res := make([]bidResponse, 0, len(bids))
+	for _, b := range bids {
+		res = append(res, bidResponse{
+			ID:        b.ID,
+			BidderID:  b.BidderID,
+			Amount:    b.Amount,
+			Status:    b.Status,
+			CreatedAt: b.CreatedAt,
+		})
+	}
+	c.Response().Header().Set(headerTotalCount, strconv.FormatInt(a.BidCount, 10))
+	return c.JSON(http.StatusOK, res)
+}
+
+// PlaceBid bids on the open auction of an item. The amount is held from the
+// balance of the user until they are outbid or the auction ends, and the
+// bidder it outbids gets their amount back.
+func (h *Handler) PlaceBid(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	itemID, err := getAuctionItemID(c)
+	if err != nil {
+		return err
+	}
+	req := new(bidRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Amount <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "amount must be greater than 0")
+	}
+
+	bid, outbid, err := h.AuctionService.Bid(ctx, userID, itemID, req.Amount)
+	if err != nil {
+		return auctionError(err)
+	}
+	h.publishBalance(c, userID)
+	if outbid.ID != 0 && outbid.BidderID != userID {
+		err := h.AlertService.Notify(ctx, []domain.Notification{{UserID: outbid.BidderID, Type: domain.NotificationTypeOutbid, ItemID: itemID}})
+		if err != nil {
+			c.Logger().Errorf("failed to notify outbid bid %d: %s", outbid.ID, err)
+		}
+		h.publishBalance(c, outbid.BidderID)
+	}
+	return c.JSON(http.StatusOK, addBidResponse{ID: bid.ID})
+}
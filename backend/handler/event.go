@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// eventKeepAlive is how often an idle stream sends a comment, so that proxies
+// do not close it.
+const eventKeepAlive = 30 * time.Second
+
+type streamTicketResponse struct {
+	Ticket string `json:"ticket"`
+}
+
+// IssueStreamTicket returns a ticket that opens the event stream of the user
+// once, within service.StreamTicketTTL.
+func (h *Handler) IssueStreamTicket(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	ticket, err := h.Hub.IssueTicket(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, streamTicketResponse{Ticket: ticket})
+}
+
+// Events streams the events of the user as Server-Sent Events, e.g.
+//
+//	event: item_sold
+//	data: {"item_id":1}
+//
+// Browsers can not set headers on an EventSource, so the stream is opened
+// with a ticket from IssueStreamTicket in the query parameter "ticket"
+// rather than with the token.
+func (h *Handler) Events(c echo.Context) error {
+	userID, ok := h.Hub.RedeemTicket(c.QueryParam("ticket"))
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired ticket")
+	}
+	events, unsubscribe := h.Hub.Subscribe(userID)
+	defer unsubscribe()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	fmt.Fprint(res, ": connected\n\n")
+	res.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-keepAlive.C:
+			fmt.Fprint(res, ": keep-alive\n\n")
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(res, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		res.Flush()
+	}
+}
+
+// publishBalance pushes the current balance of the user to their streams.
+// Like notifyListed, it only logs failures.
+func (h *Handler) publishBalance(c echo.Context, userID int64) {
+	if err := h.AlertService.PublishBalance(c.Request().Context(), userID); err != nil {
+		c.Logger().Errorf("failed to publish balance of user %d: %s", userID, err)
+	}
+}
@@ -3,17 +3,21 @@ package handler
 import (
 	"bytes"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/blobstore"
 	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
 	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
 	"github.com/kotapiku/mercari-build-hackathon-2023/backend/service"
@@ -24,6 +28,20 @@ import (
 
 const openaiURL = "https://api.openai.com/v1/chat/completions"
 
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// Headers of paginated item listings
+const (
+	headerTotalCount = "X-Total-Count"
+	headerNextCursor = "X-Next-Cursor"
+)
+
+// PageHeaders have to be exposed to the frontend by CORS.
+var PageHeaders = []string{headerTotalCount, headerNextCursor}
+
 var (
 	logFile = getEnv("LOGFILE", "access.log")
 )
@@ -66,6 +84,9 @@ type getItemResponse struct {
 	Price        int64             `json:"price"`
 	Description  string            `json:"description"`
 	Status       domain.ItemStatus `json:"status"`
+	LikeCount    int64             `json:"like_count"`
+	// Snippet is an HTML excerpt with the search matches in <mark>.
+	Snippet string `json:"snippet,omitempty"`
 }
 
 type getCategoriesResponse struct {
@@ -92,8 +113,29 @@ type addBalanceRequest struct {
 	Balance int64 `json:"balance"`
 }
 
+// getBalanceResponse has the spendable balance of the user in Available, and
+// the money of their sales that is held until the buyers receive the items in
+// Pending. Balance is the same as Available, for older clients.
 type getBalanceResponse struct {
-	Balance int64 `json:"balance"`
+	Balance   int64 `json:"balance"`
+	Available int64 `json:"available"`
+	Pending   int64 `json:"pending"`
+}
+
+type getBalanceHistoryResponse struct {
+	Balance       int64                 `json:"balance"`
+	LedgerBalance int64                 `json:"ledger_balance"`
+	Total         int64                 `json:"total"`
+	Entries       []ledgerEntryResponse `json:"entries"`
+}
+
+type ledgerEntryResponse struct {
+	ID             int64             `json:"id"`
+	Type           domain.LedgerType `json:"type"`
+	Amount         int64             `json:"amount"`
+	CounterpartyID int64             `json:"counterparty_id,omitempty"`
+	ItemID         int32             `json:"item_id,omitempty"`
+	CreatedAt      string            `json:"created_at"`
 }
 
 type editItemRequest struct {
@@ -163,10 +205,35 @@ type Response struct {
 }
 
 type Handler struct {
-	DB           *sql.DB
-	UserRepo     db.UserRepository
-	ItemRepo     db.ItemRepository
-	LoginService service.LoginService
+	DB              *db.DB
+	UserRepo        db.UserRepository
+	ItemRepo        db.ItemRepository
+	TradeRepo       db.TradeRepository
+	LedgerRepo      db.LedgerRepository
+	ItemImageRepo   db.ItemImageRepository
+	ImageStore      blobstore.Store
+	LoginService    service.LoginService
+	PurchaseService service.PurchaseService
+	// Saved searches, likes, messages and the notifications about them
+	SavedSearchRepo  db.SavedSearchRepository
+	NotificationRepo db.NotificationRepository
+	AlertService     service.AlertService
+	LikeRepo         db.LikeRepository
+	MessageRepo      db.MessageRepository
+	Hub              *service.Hub
+	// Orders of purchased items
+	OrderRepo        db.OrderRepository
+	CancellationRepo db.CancellationRepository
+	ReviewRepo       db.ReviewRepository
+	OrderService     service.OrderService
+	// Offers on items on sale
+	OfferRepo    db.OfferRepository
+	OfferService service.OfferService
+	// Holds of items on sale for one buyer
+	ReservationService service.ReservationService
+	// Auctions of items on sale
+	AuctionRepo    db.AuctionRepository
+	AuctionService service.AuctionService
 }
 
 func (h *Handler) Initialize(c echo.Context) error {
@@ -179,6 +246,9 @@ func (h *Handler) Initialize(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "Failed to initialize"))
 	}
+	if _, err := db.MoveItemImages(c.Request().Context(), h.DB, h.ImageStore); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, errors.Wrap(err, "Failed to move item images"))
+	}
 
 	return c.JSON(http.StatusOK, InitializeResponse{Message: "Success"})
 }
@@ -298,14 +368,11 @@ func (h *Handler) AddItem(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
-	file, err := c.FormFile("image")
+	images, err := readImageFiles(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 	// validation
-	if file.Size > 1<<20 {
-		return echo.NewHTTPError(http.StatusBadRequest, "file size is too large (> 1MB)")
-	}
 	if req.Price <= 0 {
 		return echo.NewHTTPError(http.StatusBadRequest, "price must be greater than 0")
 	}
@@ -313,19 +380,6 @@ func (h *Handler) AddItem(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid name")
 	}
 
-	src, err := file.Open()
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-	}
-	defer src.Close()
-
-	var dest []byte
-	blob := bytes.NewBuffer(dest)
-
-	if _, err := io.Copy(blob, src); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-	}
-
 	_, err = h.ItemRepo.GetCategory(ctx, req.CategoryID)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -334,18 +388,25 @@ func (h *Handler) AddItem(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
+	itemImages, err := h.putImages(ctx, images)
+	if err != nil {
+		return err
+	}
+
 	itemID, err := h.ItemRepo.AddItem(c.Request().Context(), domain.Item{
 		Name:        req.Name,
 		CategoryID:  req.CategoryID,
 		UserID:      userID,
 		Price:       req.Price,
 		Description: req.Description,
-		Image:       blob.Bytes(),
 		Status:      domain.ItemStatusInitial,
-	})
+	}, itemImages)
 	if err != nil {
-		if err == db.ErrConflict {
+		switch err {
+		case db.ErrConflict:
 			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case db.ErrTooManyImages:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -373,25 +434,20 @@ func (h *Handler) Sell(c echo.Context) error {
 	if item.UserID != userID {
 		return echo.NewHTTPError(http.StatusPreconditionFailed, "can not sell other's item")
 	}
-	if item.Status != domain.ItemStatusInitial {
-		return echo.NewHTTPError(http.StatusPreconditionFailed, "invalid item status")
-	}
 
-	if err := h.ItemRepo.UpdateItemStatus(ctx, item.ID, domain.ItemStatusOnSale); err != nil {
+	if err := h.ItemRepo.MoveItem(ctx, item.ID, domain.ItemStatusInitial, domain.ItemStatusOnSale, domain.ItemActorSeller, userID); err != nil {
+		if err == db.ErrInvalidItemStatus {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
+	item.Status = domain.ItemStatusOnSale
+	h.notifyListed(c, item)
 
 	return c.JSON(http.StatusOK, "successful")
 }
 
-func (h *Handler) getItems(c echo.Context, onSaleOnly bool) error {
-	ctx := c.Request().Context()
-
-	items, err := h.ItemRepo.GetItems(ctx, onSaleOnly)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
-	}
-
+func newItemsResponse(items []domain.ItemWithCategory) []getItemResponse {
 	itemsRsp := make([]getItemResponse, 0, len(items))
 	for _, item := range items {
 		itemsRsp = append(itemsRsp, getItemResponse{
@@ -403,9 +459,34 @@ func (h *Handler) getItems(c echo.Context, onSaleOnly bool) error {
 			Price:        item.Item.Price,
 			Description:  item.Item.Description,
 			Status:       item.Item.Status,
+			LikeCount:    item.LikeCount,
+			Snippet:      renderSnippet(item.Snippet),
 		})
 	}
-	return c.JSON(http.StatusOK, itemsRsp)
+	return itemsRsp
+}
+
+var snippetMarkup = strings.NewReplacer(db.SnippetOpen, "<mark>", db.SnippetClose, "</mark>")
+
+// renderSnippet escapes the item text of a snippet and marks its matches.
+func renderSnippet(snippet string) string {
+	return snippetMarkup.Replace(html.EscapeString(snippet))
+}
+
+func (h *Handler) getItems(c echo.Context, onSaleOnly bool) error {
+	ctx := c.Request().Context()
+
+	opts, err := getListOptions(c, domain.ItemSortUpdated)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	page, err := h.ItemRepo.GetItems(ctx, onSaleOnly, opts)
+	if err != nil {
+		return listItemsError(err)
+	}
+
+	setPageHeaders(c, page)
+	return c.JSON(http.StatusOK, newItemsResponse(page.Items))
 }
 
 func (h *Handler) GetOnSaleItems(c echo.Context) error {
@@ -419,17 +500,16 @@ func (h *Handler) GetOnSaleSoldOutItems(c echo.Context) error {
 func (h *Handler) GetItem(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	item, err := h.getPublicItem(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
-	item, err := h.ItemRepo.GetItem(ctx, int32(itemID))
+	category, err := h.ItemRepo.GetCategory(ctx, item.CategoryID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
-
-	category, err := h.ItemRepo.GetCategory(ctx, item.CategoryID)
+	likes, err := h.LikeRepo.CountLikes(ctx, item.ID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -443,6 +523,7 @@ func (h *Handler) GetItem(c echo.Context) error {
 			Price:        item.Price,
 			Description:  item.Description,
 			Status:       item.Status,
+			LikeCount:    likes,
 		})
 }
 
@@ -454,24 +535,21 @@ func (h *Handler) GetUserItems(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "invalid userID type")
 	}
 
-	items, err := h.ItemRepo.GetItemsByUserID(ctx, userID)
+	opts, err := getListOptions(c, domain.ItemSortNewest)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	page, err := h.ItemRepo.GetItemsByUserID(ctx, userID, opts)
+	if err != nil {
+		return listItemsError(err)
 	}
 
-	var res []getUserItemsResponse
-	for _, item := range items {
-		cats, err := h.ItemRepo.GetCategories(ctx)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, err.Error())
-		}
-		for _, cat := range cats {
-			if cat.ID == item.CategoryID {
-				res = append(res, getUserItemsResponse{ID: item.ID, Name: item.Name, Price: item.Price, CategoryName: cat.Name, Status: item.Status})
-			}
-		}
+	res := make([]getUserItemsResponse, 0, len(page.Items))
+	for _, item := range page.Items {
+		res = append(res, getUserItemsResponse{ID: item.Item.ID, Name: item.Item.Name, Price: item.Item.Price, CategoryName: item.Category.Name, Status: item.Item.Status})
 	}
 
+	setPageHeaders(c, page)
 	return c.JSON(http.StatusOK, res)
 }
 
@@ -494,17 +572,20 @@ func (h *Handler) GetCategories(c echo.Context) error {
 func (h *Handler) GetImage(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	item, err := h.getPublicItem(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "invalid itemID type")
+		return err
 	}
 
-	data, err := h.ItemRepo.GetItemImage(ctx, int32(itemID))
+	image, err := h.ItemImageRepo.GetCoverImage(ctx, item.ID)
 	if err != nil {
+		if err == db.ErrImageNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
-	return c.Blob(http.StatusOK, "image/jpeg", data)
+	return h.serveImage(c, image, cacheControlCover)
 }
 
 func DescriptRequestMessage(itemName string, description string) *DescriptionRequestMessage {
@@ -586,25 +667,34 @@ func (h *Handler) Search(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	itemName := c.QueryParam("name")
-	items, err := h.ItemRepo.SearchItem(ctx, itemName)
+	filter, err := getItemFilter(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	opts, err := getListOptions(c, domain.ItemSortRelevance)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	withFacets, err := getFacets(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	page, err := h.ItemRepo.SearchItem(ctx, itemName, filter, opts)
+	if err != nil {
+		return listItemsError(err)
 	}
 
-	itemsRsp := make([]getItemResponse, 0, len(items))
-	for _, item := range items {
-		itemsRsp = append(itemsRsp, getItemResponse{
-			ID:           item.Item.ID,
-			Name:         item.Item.Name,
-			CategoryID:   item.Category.ID,
-			CategoryName: item.Category.Name,
-			UserID:       item.Item.UserID,
-			Price:        item.Item.Price,
-			Description:  item.Item.Description,
-			Status:       item.Item.Status,
-		})
+	setPageHeaders(c, page)
+	if !withFacets {
+		return c.JSON(http.StatusOK, newItemsResponse(page.Items))
+	}
+	// each facet ignores its own filter, so the counts of the other
+	// categories and prices stay visible while one is selected
+	facets, err := h.ItemRepo.SearchFacets(ctx, itemName, filter)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
-	return c.JSON(http.StatusOK, itemsRsp)
+	return c.JSON(http.StatusOK, searchResponse{Items: newItemsResponse(page.Items), Facets: newSearchFacetsResponse(facets)})
 }
 
 func (h *Handler) AddBalance(c echo.Context) error {
@@ -628,9 +718,10 @@ func (h *Handler) AddBalance(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
 
-	if err := h.UserRepo.UpdateBalance(ctx, userID, user.Balance+req.Balance); err != nil {
+	if err := h.TradeRepo.TopUp(ctx, user.ID, req.Balance); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
+	h.publishBalance(c, user.ID)
 
 	return c.JSON(http.StatusOK, "successful")
 }
@@ -647,60 +738,85 @@ func (h *Handler) GetBalance(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
+	pending, err := h.OrderRepo.GetHeldAmount(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
 
-	return c.JSON(http.StatusOK, getBalanceResponse{Balance: user.Balance})
+	return c.JSON(http.StatusOK, getBalanceResponse{Balance: user.Balance, Available: user.Balance, Pending: pending})
 }
 
-func (h *Handler) Purchase(c echo.Context) error {
+func (h *Handler) GetBalanceHistory(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	userID, err := GetUserID(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
-
-	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-	}
-
-	item, err := h.ItemRepo.GetItem(ctx, int32(itemID))
+	limit, offset, err := getPagination(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	// user, sellerの取得
 	user, err := h.UserRepo.GetUser(ctx, userID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
-	sellerID := item.UserID
-	seller, err := h.UserRepo.GetUser(ctx, sellerID)
+	ledgerBalance, err := h.LedgerRepo.GetLedgerBalance(ctx, userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
-
-	// 売買が成立するかどうかの判定
-	if item.Status != domain.ItemStatusOnSale {
-		return echo.NewHTTPError(http.StatusPreconditionFailed, "item is not on sale")
+	total, err := h.LedgerRepo.CountEntries(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
-	if user.Balance < item.Price {
-		return echo.NewHTTPError(http.StatusPreconditionFailed, "balance is not enough")
+	entries, err := h.LedgerRepo.GetEntries(ctx, userID, limit, offset)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
-	if userID == sellerID {
-		return echo.NewHTTPError(http.StatusPreconditionFailed, "can not buy own items")
+
+	res := getBalanceHistoryResponse{
+		Balance:       user.Balance,
+		LedgerBalance: ledgerBalance,
+		Total:         total,
+		Entries:       make([]ledgerEntryResponse, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		res.Entries = append(res.Entries, ledgerEntryResponse{
+			ID:             entry.ID,
+			Type:           entry.Type,
+			Amount:         entry.Amount,
+			CounterpartyID: entry.CounterpartyID,
+			ItemID:         entry.ItemID,
+			CreatedAt:      entry.CreatedAt,
+		})
 	}
+	return c.JSON(http.StatusOK, res)
+}
 
-	// 売買
-	if err := h.UserRepo.UpdateBalance(ctx, userID, user.Balance-item.Price); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+func (h *Handler) Purchase(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
-	if err := h.UserRepo.UpdateBalance(ctx, sellerID, seller.Balance+item.Price); err != nil {
+
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
-	if err := h.ItemRepo.UpdateItemStatus(ctx, int32(itemID), domain.ItemStatusSoldOut); err != nil {
+
+	if _, err := h.PurchaseService.Purchase(ctx, userID, int32(itemID)); err != nil {
+		switch err {
+		case service.ErrItemNotFound:
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case service.ErrOwnItem, db.ErrItemNotOnSale, db.ErrItemReserved, db.ErrItemAuctioned, db.ErrInsufficientBalance:
+			return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
+	h.notifyPurchased(c, int32(itemID), userID)
 
 	return c.JSON(http.StatusOK, "successful")
 }
@@ -746,9 +862,13 @@ func (h *Handler) EditItem(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "price must be greater than 0")
 	}
 
+	// held, sold and auctioned items are refused by EditItem
 	err = h.ItemRepo.EditItem(ctx, int32(id), req.Name, req.CategoryID, req.Price, req.Description)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return itemStateError(err)
+	}
+	if item.Status == domain.ItemStatusOnSale && req.Price < item.Price {
+		h.notifyWatchers(c, item.ID, domain.NotificationTypePriceDrop, userID)
 	}
 
 	return c.JSON(http.StatusOK, "successful")
@@ -762,6 +882,86 @@ func getEnv(key string, defaultValue string) string {
 	return value
 }
 
+// getLimit reads the "limit" query parameter.
+func getLimit(c echo.Context) (int, error) {
+	limit := defaultPageLimit
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid limit: %s", v)
+		}
+		limit = n
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return limit, nil
+}
+
+// getPagination reads the "limit" and "offset" query parameters.
+func getPagination(c echo.Context) (int, int, error) {
+	limit, err := getLimit(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	offset := 0
+	if v := c.QueryParam("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", v)
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+// getListOptions reads the "limit", "sort" and "cursor" query parameters of
+// item listings. The cursor is the X-Next-Cursor header of the previous page.
+func getListOptions(c echo.Context, defaultSort domain.ItemSort) (db.ItemListOptions, error) {
+	limit, err := getLimit(c)
+	if err != nil {
+		return db.ItemListOptions{}, err
+	}
+	opts := db.ItemListOptions{Sort: defaultSort, Limit: limit}
+	if v := c.QueryParam("sort"); v != "" {
+		opts.Sort = domain.ItemSort(v)
+		switch opts.Sort {
+		case domain.ItemSortNewest, domain.ItemSortPriceAsc, domain.ItemSortPriceDesc, domain.ItemSortUpdated, domain.ItemSortRelevance:
+		default:
+			return db.ItemListOptions{}, fmt.Errorf("invalid sort: %s", v)
+		}
+	}
+	if v := c.QueryParam("cursor"); v != "" {
+		b, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return db.ItemListOptions{}, db.ErrInvalidCursor
+		}
+		opts.After = new(db.ItemCursor)
+		if err := json.Unmarshal(b, opts.After); err != nil {
+			return db.ItemListOptions{}, db.ErrInvalidCursor
+		}
+	}
+	return opts, nil
+}
+
+// setPageHeaders reports the total count and the cursor of the next page of an
+// item listing. Listings respond with a plain array, so they are headers.
+func setPageHeaders(c echo.Context, page db.ItemPage) {
+	header := c.Response().Header()
+	header.Set(headerTotalCount, strconv.FormatInt(page.Total, 10))
+	if page.Next != nil {
+		b, _ := json.Marshal(page.Next)
+		header.Set(headerNextCursor, base64.RawURLEncoding.EncodeToString(b))
+	}
+}
+
+func listItemsError(err error) error {
+	if err == db.ErrInvalidCursor || err == db.ErrUnsupportedSort {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
 func GetUserID(c echo.Context) (int64, error) {
 	user := c.Get("user").(*jwt.Token)
 	if user == nil {
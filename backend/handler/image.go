@@ -0,0 +1,400 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/blobstore"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/imaging"
+	"github.com/labstack/echo/v4"
+)
+
+const maxImageSize = 1 << 20
+
+// Values of the size query parameter of the image endpoints
+const (
+	imageSizeOriginal  = "original"
+	imageSizeMedium    = "medium"
+	imageSizeThumbnail = "thumbnail"
+)
+
+type itemImageResponse struct {
+	ID           int64  `json:"id"`
+	Position     int    `json:"position"`
+	IsCover      bool   `json:"is_cover"`
+	URL          string `json:"url"`
+	MediumURL    string `json:"medium_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+type reorderImagesRequest struct {
+	ImageIDs []int64 `json:"image_ids"`
+}
+
+func newItemImagesResponse(images []domain.ItemImage) []itemImageResponse {
+	res := make([]itemImageResponse, 0, len(images))
+	for _, img := range images {
+		url := fmt.Sprintf("/items/%d/images/%d", img.ItemID, img.ID)
+		res = append(res, itemImageResponse{
+			ID:           img.ID,
+			Position:     img.Position,
+			IsCover:      img.IsCover,
+			URL:          url,
+			MediumURL:    url + "?size=" + imageSizeMedium,
+			ThumbnailURL: url + "?size=" + imageSizeThumbnail,
+		})
+	}
+	return res
+}
+
+// readImageFiles reads every "image" file of the multipart form and rejects
+// files that are not a supported image format.
+func readImageFiles(c echo.Context) ([][]byte, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	files := form.File["image"]
+	if len(files) == 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "image is required")
+	}
+	if len(files) > domain.MaxItemImages {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("too many images (> %d)", domain.MaxItemImages))
+	}
+
+	images := make([][]byte, 0, len(files))
+	for _, file := range files {
+		if file.Size > maxImageSize {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "file size is too large (> 1MB)")
+		}
+		src, err := file.Open()
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		data, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if _, err := imaging.Sniff(data); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		images = append(images, data)
+	}
+	return images, nil
+}
+
+// putImages sanitizes the uploaded images and stores them together with their
+// renditions.
+func (h *Handler) putImages(ctx context.Context, images [][]byte) ([]domain.ItemImage, error) {
+	res := make([]domain.ItemImage, 0, len(images))
+	for _, image := range images {
+		sanitized, _, err := imaging.Sanitize(image)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid image: "+err.Error())
+		}
+		key, err := h.putBlob(ctx, sanitized)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		thumbnailKey, mediumKey, err := h.putRenditions(ctx, sanitized)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		res = append(res, domain.ItemImage{ImageKey: key, ThumbnailKey: thumbnailKey, MediumKey: mediumKey})
+	}
+	return res, nil
+}
+
+func (h *Handler) putRenditions(ctx context.Context, image []byte) (string, string, error) {
+	thumbnail, err := imaging.Resize(image, imaging.ThumbnailSize)
+	if err != nil {
+		return "", "", err
+	}
+	medium, err := imaging.Resize(image, imaging.MediumSize)
+	if err != nil {
+		return "", "", err
+	}
+	thumbnailKey, err := h.putBlob(ctx, thumbnail)
+	if err != nil {
+		return "", "", err
+	}
+	mediumKey, err := h.putBlob(ctx, medium)
+	return thumbnailKey, mediumKey, err
+}
+
+// putBlob stores data in the image store, after taking its key off the blobs
+// of deleted images waiting to be swept.
+func (h *Handler) putBlob(ctx context.Context, data []byte) (string, error) {
+	if err := h.ItemImageRepo.ClaimImageKeys(ctx, []string{blobstore.Key(data)}); err != nil {
+		return "", err
+	}
+	return h.ImageStore.Put(ctx, data)
+}
+
+// Cache-Control of the image endpoints. An image id always refers to the same
+// content, while the cover of an item may change.
+const (
+	cacheControlImage = "public, max-age=31536000, immutable"
+	cacheControlCover = "public, max-age=60"
+)
+
+// renditionKey returns the blob key of the rendition of image chosen by size.
+// Renditions missing for images stored before they were introduced are
+// rendered on the first request.
+func (h *Handler) renditionKey(ctx context.Context, image domain.ItemImage, size string) (string, error) {
+	if size != imageSizeMedium && size != imageSizeThumbnail {
+		return image.ImageKey, nil
+	}
+	if image.ThumbnailKey == "" || image.MediumKey == "" {
+		data, err := h.ImageStore.Get(ctx, image.ImageKey)
+		if err != nil {
+			return "", err
+		}
+		image.ThumbnailKey, image.MediumKey, err = h.putRenditions(ctx, data)
+		if err == imaging.ErrUnsupportedFormat {
+			// legacy images are not validated, serve them as they are
+			return image.ImageKey, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := h.ItemImageRepo.SetRenditions(ctx, image.ID, image.ThumbnailKey, image.MediumKey); err != nil {
+			return "", err
+		}
+	}
+	if size == imageSizeThumbnail {
+		return image.ThumbnailKey, nil
+	}
+	return image.MediumKey, nil
+}
+
+// serveImage responds with the rendition of image chosen by the size query
+// parameter. Blob keys are content hashes, so they double as strong ETags and
+// a revalidation never has to read the blob.
+func (h *Handler) serveImage(c echo.Context, image domain.ItemImage, cacheControl string) error {
+	ctx := c.Request().Context()
+
+	size := c.QueryParam("size")
+	switch size {
+	case "", imageSizeOriginal, imageSizeMedium, imageSizeThumbnail:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "size must be one of original, medium or thumbnail")
+	}
+
+	item, err := h.ItemRepo.GetItem(ctx, image.ItemID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	key, err := h.renditionKey(ctx, image, size)
+	if err != nil {
+		if err == blobstore.ErrNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	etag := `"` + key + `"`
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", cacheControl)
+	lastModified, err := time.ParseInLocation(domain.TimestampLayout, item.UpdatedAt, time.Local)
+	if err == nil {
+		header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(c.Request(), etag, lastModified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	data, err := h.ImageStore.Get(ctx, key)
+	if err != nil {
+		if err == blobstore.ErrNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	header.Set(echo.HeaderContentLength, strconv.Itoa(len(data)))
+	return c.Blob(http.StatusOK, imaging.ContentType(data), data)
+}
+
+// notModified evaluates the conditional headers of req. As in RFC 9110,
+// If-Modified-Since is ignored when If-None-Match is present.
+func notModified(req *http.Request, etag string, lastModified time.Time) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	ims, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+// getOwnItem returns the item of the itemID path parameter if the login user
+// is its seller and can still change it, like EditItem.
+func (h *Handler) getOwnItem(c echo.Context) (domain.Item, error) {
+	ctx := c.Request().Context()
+
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	if err != nil {
+		return domain.Item{}, echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+	userID, err := GetUserID(c)
+	if err != nil {
+		return domain.Item{}, echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	item, err := h.ItemRepo.GetItem(ctx, int32(itemID))
+	if err != nil {
+		return domain.Item{}, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if item.UserID != userID {
+		return domain.Item{}, echo.NewHTTPError(http.StatusPreconditionFailed, "can not update other's item")
+	}
+	if !item.Status.Editable() {
+		return domain.Item{}, itemStateError(db.ErrInvalidItemStatus)
+	}
+	return item, nil
+}
+
+func imageErrorStatus(err error) int {
+	switch err {
+	case db.ErrImageNotFound:
+		return http.StatusNotFound
+	case db.ErrTooManyImages, db.ErrLastImage, db.ErrInvalidOrdering:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) GetItemImages(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	item, err := h.getPublicItem(c)
+	if err != nil {
+		return err
+	}
+
+	images, err := h.ItemImageRepo.GetImages(ctx, item.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, newItemImagesResponse(images))
+}
+
+func (h *Handler) GetItemImage(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	item, err := h.getPublicItem(c)
+	if err != nil {
+		return err
+	}
+	imageID, err := strconv.ParseInt(c.Param("imageID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid imageID type")
+	}
+
+	image, err := h.ItemImageRepo.GetImage(ctx, item.ID, imageID)
+	if err != nil {
+		return echo.NewHTTPError(imageErrorStatus(err), err.Error())
+	}
+	return h.serveImage(c, image, cacheControlImage)
+}
+
+func (h *Handler) AddItemImages(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	item, err := h.getOwnItem(c)
+	if err != nil {
+		return err
+	}
+	images, err := readImageFiles(c)
+	if err != nil {
+		return err
+	}
+
+	itemImages, err := h.putImages(ctx, images)
+	if err != nil {
+		return err
+	}
+	added, err := h.ItemImageRepo.AddImages(ctx, item.ID, itemImages)
+	if err != nil {
+		return echo.NewHTTPError(imageErrorStatus(err), err.Error())
+	}
+	return c.JSON(http.StatusOK, newItemImagesResponse(added))
+}
+
+func (h *Handler) ReorderItemImages(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	item, err := h.getOwnItem(c)
+	if err != nil {
+		return err
+	}
+	req := new(reorderImagesRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.ItemImageRepo.ReorderImages(ctx, item.ID, req.ImageIDs); err != nil {
+		return echo.NewHTTPError(imageErrorStatus(err), err.Error())
+	}
+	images, err := h.ItemImageRepo.GetImages(ctx, item.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, newItemImagesResponse(images))
+}
+
+func (h *Handler) SetCoverImage(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	item, err := h.getOwnItem(c)
+	if err != nil {
+		return err
+	}
+	imageID, err := strconv.ParseInt(c.Param("imageID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid imageID type")
+	}
+
+	if err := h.ItemImageRepo.SetCoverImage(ctx, item.ID, imageID); err != nil {
+		return echo.NewHTTPError(imageErrorStatus(err), err.Error())
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+func (h *Handler) DeleteItemImage(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	item, err := h.getOwnItem(c)
+	if err != nil {
+		return err
+	}
+	imageID, err := strconv.ParseInt(c.Param("imageID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid imageID type")
+	}
+
+	// the blobs are removed later by service.ImageService
+	if err := h.ItemImageRepo.DeleteImage(ctx, item.ID, imageID); err != nil {
+		return echo.NewHTTPError(imageErrorStatus(err), err.Error())
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
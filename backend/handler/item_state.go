@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+)
+
+type itemStatusChangeResponse struct {
+	ID int64 `json:"id"`
+	// From is 0 for the creation of the item.
+	From  domain.ItemStatus `json:"from"`
+	To    domain.ItemStatus `json:"to"`
+	Actor domain.ItemActor  `json:"actor"`
+	// UserID is 0 when the server made the change.
+	UserID    int64  `json:"user_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// getPublicItem returns the item of the itemID parameter for the endpoints
+// anyone can call. Deleted items are not found, along with their images,
+// comments and auctions.
+func (h *Handler) getPublicItem(c echo.Context) (domain.Item, error) {
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	if err != nil {
+		return domain.Item{}, echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+	item, err := h.ItemRepo.GetItem(c.Request().Context(), int32(itemID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Item{}, echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return domain.Item{}, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if item.Status == domain.ItemStatusDeleted {
+		return domain.Item{}, echo.NewHTTPError(http.StatusNotFound, "item is deleted")
+	}
+	return item, nil
+}
+
+// getSellerItem returns the item of the itemID parameter, which must belong
+// to the user.
+func (h *Handler) getSellerItem(c echo.Context, userID int64) (domain.Item, error) {
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	if err != nil {
+		return domain.Item{}, echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+	item, err := h.ItemRepo.GetItem(c.Request().Context(), int32(itemID))
+	if err != nil {
+		return domain.Item{}, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if item.UserID != userID {
+		return domain.Item{}, echo.NewHTTPError(http.StatusPreconditionFailed, "can not access other's item")
+	}
+	return item, nil
+}
+
+// GetItemHistory lists the changes of status of an item of the user, oldest
+// first, with who made them and when.
+func (h *Handler) GetItemHistory(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	item, err := h.getSellerItem(c, userID)
+	if err != nil {
+		return err
+	}
+
+	history, err := h.ItemRepo.GetItemHistory(c.Request().Context(), item.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	res := make([]itemStatusChangeResponse, 0, len(history))
+	for _, change := range history {
+		res = append(res, itemStatusChangeResponse{
+			ID:        change.ID,
+			From:      change.From,
+			To:        change.To,
+			Actor:     change.Actor,
+			UserID:    change.UserID,
+			CreatedAt: change.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func itemStateError(err error) error {
+	switch err {
+	case db.ErrInvalidItemStatus, db.ErrItemAuctioned:
+		return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// withdrawItem takes the item of the itemID parameter off sale to the status
+// to, on behalf of its seller.
+func (h *Handler) withdrawItem(c echo.Context, to domain.ItemStatus) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	item, err := h.getSellerItem(c, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := h.ItemRepo.WithdrawItem(c.Request().Context(), item.ID, to, userID); err != nil {
+		return itemStateError(err)
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// DeleteItem removes a draft, paused or on sale item of the user. The item is
+// kept with its history, but it is not shown anywhere anymore. Sold and
+// reserved items can not be deleted.
+func (h *Handler) DeleteItem(c echo.Context) error {
+	return h.withdrawItem(c, domain.ItemStatusDeleted)
+}
+
+// UnlistItem takes an item on sale or paused back to a draft.
+func (h *Handler) UnlistItem(c echo.Context) error {
+	return h.withdrawItem(c, domain.ItemStatusInitial)
+}
+
+// PauseItem hides an item on sale from listings and searches until it is
+// unpaused.
+func (h *Handler) PauseItem(c echo.Context) error {
+	return h.withdrawItem(c, domain.ItemStatusPaused)
+}
+
+// UnpauseItem relists a paused item.
+func (h *Handler) UnpauseItem(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	item, err := h.getSellerItem(c, userID)
+	if err != nil {
+		return err
+	}
+	if err := h.ItemRepo.MoveItem(c.Request().Context(), item.ID, domain.ItemStatusPaused, domain.ItemStatusOnSale, domain.ItemActorSeller, userID); err != nil {
+		return itemStateError(err)
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
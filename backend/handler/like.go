@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+)
+
+type likeResponse struct {
+	Liked     bool  `json:"liked"`
+	LikeCount int64 `json:"like_count"`
+}
+
+// getLikedItem returns the item of the itemID parameter for liking it.
+func (h *Handler) getLikedItem(c echo.Context) (domain.Item, error) {
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	if err != nil {
+		return domain.Item{}, echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+	item, err := h.ItemRepo.GetItem(c.Request().Context(), int32(itemID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Item{}, echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return domain.Item{}, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return item, nil
+}
+
+func (h *Handler) likeResponse(c echo.Context, itemID int32, liked bool) error {
+	count, err := h.LikeRepo.CountLikes(c.Request().Context(), itemID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, likeResponse{Liked: liked, LikeCount: count})
+}
+
+// LikeItem adds the item to the watchlist of the user, who is then notified
+// when its price drops or it is sold. Liking an item twice does nothing.
+func (h *Handler) LikeItem(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	item, err := h.getLikedItem(c)
+	if err != nil {
+		return err
+	}
+	if !item.Status.Public() {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "invalid item status")
+	}
+
+	if err := h.LikeRepo.AddLike(ctx, userID, item.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return h.likeResponse(c, item.ID, true)
+}
+
+// UnlikeItem removes the item from the watchlist of the user. Unliking an
+// item that is not liked does nothing.
+func (h *Handler) UnlikeItem(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	item, err := h.getLikedItem(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.LikeRepo.RemoveLike(ctx, userID, item.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return h.likeResponse(c, item.ID, false)
+}
+
+func (h *Handler) GetMyLikes(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	opts, err := getListOptions(c, domain.ItemSortNewest)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	page, err := h.LikeRepo.GetLikedItems(ctx, userID, opts)
+	if err != nil {
+		return listItemsError(err)
+	}
+
+	setPageHeaders(c, page)
+	return c.JSON(http.StatusOK, newItemsResponse(page.Items))
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+)
+
+type messageRequest struct {
+	Body string `json:"body"`
+}
+
+type messageResponse struct {
+	ID         int64  `json:"id"`
+	SenderID   int64  `json:"sender_id"`
+	SenderName string `json:"sender_name"`
+	Body       string `json:"body"`
+	IsRead     bool   `json:"is_read"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type addMessageResponse struct {
+	ID int64 `json:"id"`
+}
+
+// getThreadOrder returns the order of the item of the itemID parameter whose
+// private thread the user can see: the latest order of the item for its
+// seller, and the latest order of the user for a buyer. A buyer whose order
+// was cancelled keeps their own thread, but never sees the next buyer's.
+func (h *Handler) getThreadOrder(c echo.Context) (domain.Order, int64, error) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return domain.Order{}, 0, echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	item, err := h.getPublicItem(c)
+	if err != nil {
+		return domain.Order{}, 0, err
+	}
+
+	buyerID := userID
+	if userID == item.UserID {
+		buyerID = 0
+	}
+	order, err := h.OrderRepo.GetItemOrder(c.Request().Context(), item.ID, buyerID)
+	if err == db.ErrOrderNotFound {
+		if buyerID == 0 {
+			return domain.Order{}, 0, echo.NewHTTPError(http.StatusPreconditionFailed, "item has not been purchased")
+		}
+		return domain.Order{}, 0, echo.NewHTTPError(http.StatusPreconditionFailed, "can not see other's messages")
+	}
+	if err != nil {
+		return domain.Order{}, 0, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return order, userID, nil
+}
+
+// listMessages lists the public comments on the item, or the private thread
+// of the order unless orderID is 0.
+func (h *Handler) listMessages(c echo.Context, itemID int32, orderID int64) error {
+	ctx := c.Request().Context()
+
+	limit, offset, err := getPagination(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	total, err := h.MessageRepo.CountMessages(ctx, itemID, orderID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	messages, err := h.MessageRepo.GetMessages(ctx, itemID, orderID, limit, offset)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	res := make([]messageResponse, 0, len(messages))
+	for _, m := range messages {
+		res = append(res, messageResponse{
+			ID:         m.ID,
+			SenderID:   m.SenderID,
+			SenderName: m.SenderName,
+			Body:       m.Body,
+			IsRead:     m.IsRead,
+			CreatedAt:  m.CreatedAt,
+		})
+	}
+	c.Response().Header().Set(headerTotalCount, strconv.FormatInt(total, 10))
+	return c.JSON(http.StatusOK, res)
+}
+
+// postMessage adds a message from the user to recipientID, who is notified
+// unless recipientID is 0. The message is private to the order unless
+// orderID is 0.
+func (h *Handler) postMessage(c echo.Context, itemID int32, orderID int64, userID, recipientID int64) error {
+	ctx := c.Request().Context()
+
+	req := new(messageRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "body is empty")
+	}
+	if utf8.RuneCountInString(body) > domain.MaxMessageLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("body is longer than %d characters", domain.MaxMessageLength))
+	}
+
+	id, err := h.MessageRepo.AddMessage(ctx, domain.Message{
+		ItemID:      itemID,
+		OrderID:     orderID,
+		SenderID:    userID,
+		RecipientID: recipientID,
+		Body:        body,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if recipientID != 0 {
+		err := h.AlertService.Notify(ctx, []domain.Notification{{UserID: recipientID, Type: domain.NotificationTypeMessage, ItemID: itemID}})
+		if err != nil {
+			c.Logger().Errorf("failed to notify user %d of message %d: %s", recipientID, id, err)
+		}
+	}
+	return c.JSON(http.StatusOK, addMessageResponse{ID: id})
+}
+
+// GetComments lists the public comments on an item, oldest first.
+func (h *Handler) GetComments(c echo.Context) error {
+	item, err := h.getPublicItem(c)
+	if err != nil {
+		return err
+	}
+	return h.listMessages(c, item.ID, 0)
+}
+
+// AddComment asks the seller a question about an item on sale, or answers
+// one when the user is the seller.
+func (h *Handler) AddComment(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	item, err := h.getPublicItem(c)
+	if err != nil {
+		return err
+	}
+	if !item.Status.ForSale() {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "invalid item status")
+	}
+
+	var recipientID int64
+	if userID != item.UserID {
+		recipientID = item.UserID
+	}
+	return h.postMessage(c, item.ID, 0, userID, recipientID)
+}
+
+// ReadComments marks the comments on the user's item as read.
+func (h *Handler) ReadComments(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	item, err := h.getPublicItem(c)
+	if err != nil {
+		return err
+	}
+	if err := h.MessageRepo.MarkMessagesRead(c.Request().Context(), item.ID, 0, userID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// GetMessages lists the private thread of the seller and the buyer of an
+// order of the item, oldest first.
+func (h *Handler) GetMessages(c echo.Context) error {
+	order, _, err := h.getThreadOrder(c)
+	if err != nil {
+		return err
+	}
+	return h.listMessages(c, order.ItemID, order.ID)
+}
+
+func (h *Handler) AddMessage(c echo.Context) error {
+	order, userID, err := h.getThreadOrder(c)
+	if err != nil {
+		return err
+	}
+
+	recipientID := order.BuyerID
+	if userID == order.BuyerID {
+		recipientID = order.SellerID
+	}
+	return h.postMessage(c, order.ItemID, order.ID, userID, recipientID)
+}
+
+// ReadMessages marks the private messages to the user as read.
+func (h *Handler) ReadMessages(c echo.Context) error {
+	order, userID, err := h.getThreadOrder(c)
+	if err != nil {
+		return err
+	}
+	if err := h.MessageRepo.MarkMessagesRead(c.Request().Context(), order.ItemID, order.ID, userID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
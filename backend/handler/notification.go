@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// maxSavedSearchQuery is the length of saved_searches.query in characters.
+const maxSavedSearchQuery = 255
+
+type savedSearchRequest struct {
+	Query       string  `json:"query"`
+	CategoryIDs []int64 `json:"category_ids"`
+	MinPrice    int64   `json:"min_price"`
+	MaxPrice    int64   `json:"max_price"`
+	SellerID    int64   `json:"seller_id"`
+}
+
+type savedSearchResponse struct {
+	ID          int64   `json:"id"`
+	Query       string  `json:"query"`
+	CategoryIDs []int64 `json:"category_ids"`
+	MinPrice    int64   `json:"min_price"`
+	MaxPrice    int64   `json:"max_price"`
+	SellerID    int64   `json:"seller_id"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+type addSavedSearchResponse struct {
+	ID int64 `json:"id"`
+}
+
+type notificationResponse struct {
+	ID            int64                   `json:"id"`
+	Type          domain.NotificationType `json:"type"`
+	ItemID        int32                   `json:"item_id"`
+	ItemName      string                  `json:"item_name"`
+	SavedSearchID int64                   `json:"saved_search_id,omitempty"`
+	IsRead        bool                    `json:"is_read"`
+	CreatedAt     string                  `json:"created_at"`
+}
+
+type readNotificationsRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+func (h *Handler) validateSavedSearch(c echo.Context, req *savedSearchRequest) error {
+	if utf8.RuneCountInString(req.Query) > maxSavedSearchQuery {
+		return fmt.Errorf("query is longer than %d characters", maxSavedSearchQuery)
+	}
+	if req.MinPrice < 0 || req.MaxPrice < 0 || (req.MaxPrice > 0 && req.MaxPrice < req.MinPrice) {
+		return errors.New("invalid price range")
+	}
+	if req.Query == "" && len(req.CategoryIDs) == 0 && req.MinPrice == 0 && req.MaxPrice == 0 && req.SellerID == 0 {
+		return errors.New("saved search needs a query or a filter")
+	}
+	for _, id := range req.CategoryIDs {
+		if _, err := h.ItemRepo.GetCategory(c.Request().Context(), id); err != nil {
+			return fmt.Errorf("invalid category_id: %d", id)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) AddSavedSearch(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	req := new(savedSearchRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := h.validateSavedSearch(c, req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	count, err := h.SavedSearchRepo.CountSavedSearches(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if count >= domain.MaxSavedSearches {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("can not save more than %d searches", domain.MaxSavedSearches))
+	}
+
+	id, err := h.SavedSearchRepo.AddSavedSearch(ctx, domain.SavedSearch{
+		UserID:      userID,
+		Query:       req.Query,
+		CategoryIDs: req.CategoryIDs,
+		MinPrice:    req.MinPrice,
+		MaxPrice:    req.MaxPrice,
+		SellerID:    req.SellerID,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, addSavedSearchResponse{ID: id})
+}
+
+func (h *Handler) GetSavedSearches(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	searches, err := h.SavedSearchRepo.GetSavedSearches(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	res := make([]savedSearchResponse, 0, len(searches))
+	for _, search := range searches {
+		categoryIDs := search.CategoryIDs
+		if categoryIDs == nil {
+			categoryIDs = []int64{}
+		}
+		res = append(res, savedSearchResponse{
+			ID:          search.ID,
+			Query:       search.Query,
+			CategoryIDs: categoryIDs,
+			MinPrice:    search.MinPrice,
+			MaxPrice:    search.MaxPrice,
+			SellerID:    search.SellerID,
+			CreatedAt:   search.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) DeleteSavedSearch(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	id, err := strconv.ParseInt(c.Param("searchID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid searchID type")
+	}
+
+	if err := h.SavedSearchRepo.DeleteSavedSearch(ctx, userID, id); err != nil {
+		if errors.Is(err, db.ErrSavedSearchNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// GetNotifications returns the inbox of the user, newest first. The query
+// parameter "unread=true" leaves out read notifications.
+func (h *Handler) GetNotifications(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	limit, offset, err := getPagination(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	unreadOnly := false
+	if v := c.QueryParam("unread"); v != "" {
+		if unreadOnly, err = strconv.ParseBool(v); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid unread: %s", v))
+		}
+	}
+
+	total, err := h.NotificationRepo.CountNotifications(ctx, userID, unreadOnly)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	notifications, err := h.NotificationRepo.GetNotifications(ctx, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	res := make([]notificationResponse, 0, len(notifications))
+	for _, n := range notifications {
+		res = append(res, notificationResponse{
+			ID:            n.ID,
+			Type:          n.Type,
+			ItemID:        n.ItemID,
+			ItemName:      n.ItemName,
+			SavedSearchID: n.SavedSearchID,
+			IsRead:        n.IsRead,
+			CreatedAt:     n.CreatedAt,
+		})
+	}
+	c.Response().Header().Set(headerTotalCount, strconv.FormatInt(total, 10))
+	return c.JSON(http.StatusOK, res)
+}
+
+// ReadNotifications marks the given notifications as read, or every
+// notification of the user when no ids are given.
+func (h *Handler) ReadNotifications(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	req := new(readNotificationsRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if len(req.IDs) > maxPageLimit {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("can not mark more than %d notifications at once", maxPageLimit))
+	}
+
+	if err := h.NotificationRepo.MarkNotificationsRead(ctx, userID, req.IDs); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// notifyListed sends the alerts of saved searches for an item just put on
+// sale. The item is on sale regardless, so failures are only logged.
+func (h *Handler) notifyListed(c echo.Context, item domain.Item) {
+	if err := h.AlertService.NotifyListed(c.Request().Context(), item); err != nil {
+		c.Logger().Errorf("failed to notify saved searches of item %d: %s", item.ID, err)
+	}
+}
+
+// notifyPurchased notifies the seller and the watchers of a purchased item,
+// and pushes the new balances of the buyer and the seller, whose pending
+// amount has grown. Like notifyListed, it only logs failures.
+func (h *Handler) notifyPurchased(c echo.Context, itemID int32, buyerID int64) {
+	item, err := h.ItemRepo.GetItem(c.Request().Context(), itemID)
+	if err != nil {
+		c.Logger().Errorf("failed to notify purchase of item %d: %s", itemID, err)
+		return
+	}
+	if err := h.AlertService.NotifyPurchased(c.Request().Context(), item, buyerID); err != nil {
+		c.Logger().Errorf("failed to notify purchase of item %d: %s", itemID, err)
+	}
+	h.publishBalance(c, buyerID)
+	h.publishBalance(c, item.UserID)
+}
+
+// notifyWatchers notifies the users who like an item, except userID who
+// changed it. Like notifyListed, it only logs failures.
+func (h *Handler) notifyWatchers(c echo.Context, itemID int32, notificationType domain.NotificationType, userID int64) {
+	if err := h.AlertService.NotifyWatchers(c.Request().Context(), itemID, notificationType, userID); err != nil {
+		c.Logger().Errorf("failed to notify watchers of item %d: %s", itemID, err)
+	}
+}
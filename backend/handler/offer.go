@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/service"
+	"github.com/labstack/echo/v4"
+)
+
+type offerRequest struct {
+	Price int64 `json:"price"`
+}
+
+type offerResponse struct {
+	ID       int64              `json:"id"`
+	ItemID   int32              `json:"item_id"`
+	ItemName string             `json:"item_name"`
+	BuyerID  int64              `json:"buyer_id"`
+	SellerID int64              `json:"seller_id"`
+	Price    int64              `json:"price"`
+	Status   domain.OfferStatus `json:"status"`
+	// ExpiresAt is when an accepted offer stops reserving the item.
+	ExpiresAt string `json:"expires_at,omitempty"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type addOfferResponse struct {
+	ID int64 `json:"id"`
+}
+
+func newOfferResponse(o domain.Offer) offerResponse {
+	return offerResponse{
+		ID:        o.ID,
+		ItemID:    o.ItemID,
+		ItemName:  o.ItemName,
+		BuyerID:   o.BuyerID,
+		SellerID:  o.SellerID,
+		Price:     o.Price,
+		Status:    o.Status,
+		ExpiresAt: o.ExpiresAt,
+		CreatedAt: o.CreatedAt,
+		UpdatedAt: o.UpdatedAt,
+	}
+}
+
+func offerError(err error) error {
+	switch err {
+	case db.ErrOfferNotFound, service.ErrItemNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case service.ErrOwnItem, service.ErrNotOfferParty, service.ErrWrongParty, db.ErrItemNotOnSale, db.ErrItemReserved, db.ErrItemAuctioned, db.ErrOfferOpen, db.ErrInvalidOfferStatus:
+		return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
+	case db.ErrInvalidOfferPrice:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// getOfferPrice reads the price of an offer from the request.
+func getOfferPrice(c echo.Context) (int64, error) {
+	req := new(offerRequest)
+	if err := c.Bind(req); err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Price <= 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "price must be positive")
+	}
+	return req.Price, nil
+}
+
+// notifyOffer tells the party of an offer other than userID about it.
+func (h *Handler) notifyOffer(c echo.Context, offer domain.Offer, userID int64, notificationType domain.NotificationType) {
+	recipientID := offer.SellerID
+	if userID == offer.SellerID {
+		recipientID = offer.BuyerID
+	}
+	err := h.AlertService.Notify(c.Request().Context(), []domain.Notification{{UserID: recipientID, Type: notificationType, ItemID: offer.ItemID}})
+	if err != nil {
+		c.Logger().Errorf("failed to notify offer %d: %s", offer.ID, err)
+	}
+}
+
+// MakeOffer offers the seller of an item on sale a price lower than the one
+// listed.
+func (h *Handler) MakeOffer(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+	price, err := getOfferPrice(c)
+	if err != nil {
+		return err
+	}
+
+	offer, err := h.OfferService.MakeOffer(c.Request().Context(), userID, int32(itemID), price)
+	if err != nil {
+		return offerError(err)
+	}
+	h.notifyOffer(c, offer, userID, domain.NotificationTypeOffer)
+	return c.JSON(http.StatusOK, addOfferResponse{ID: offer.ID})
+}
+
+// GetOffers lists the offers of the user, newest first. The query parameter
+// "role" is "buyer" or "seller" to list only the offers the user has made or
+// received.
+func (h *Handler) GetOffers(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	limit, offset, err := getPagination(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	role := domain.OrderRole(c.QueryParam("role"))
+	switch role {
+	case "", domain.OrderRoleBuyer, domain.OrderRoleSeller:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid role: %s", role))
+	}
+
+	total, err := h.OfferRepo.CountOffers(ctx, userID, role)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	offers, err := h.OfferRepo.GetOffers(ctx, userID, role, limit, offset)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	res := make([]offerResponse, 0, len(offers))
+	for _, o := range offers {
+		res = append(res, newOfferResponse(o))
+	}
+	c.Response().Header().Set(headerTotalCount, strconv.FormatInt(total, 10))
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) GetOffer(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	offerID, err := strconv.ParseInt(c.Param("offerID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid offerID type")
+	}
+
+	offer, err := h.OfferService.GetOffer(c.Request().Context(), userID, offerID)
+	if err != nil {
+		return offerError(err)
+	}
+	return c.JSON(http.StatusOK, newOfferResponse(offer))
+}
+
+// answerOffer reads the user and the offerID parameter, calls answer with
+// them and tells the other party about the answer with notificationType.
+func (h *Handler) answerOffer(c echo.Context, notificationType domain.NotificationType, answer func(userID, offerID int64) (domain.Offer, error)) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	offerID, err := strconv.ParseInt(c.Param("offerID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid offerID type")
+	}
+
+	offer, err := answer(userID, offerID)
+	if err != nil {
+		return offerError(err)
+	}
+	h.notifyOffer(c, offer, userID, notificationType)
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// AcceptOffer agrees to the price of an offer. The item is reserved for the
+// buyer, who alone can purchase it at that price until the offer expires.
+func (h *Handler) AcceptOffer(c echo.Context) error {
+	return h.answerOffer(c, domain.NotificationTypeOfferAccepted, func(userID, offerID int64) (domain.Offer, error) {
+		return h.OfferService.Accept(c.Request().Context(), userID, offerID)
+	})
+}
+
+func (h *Handler) RejectOffer(c echo.Context) error {
+	return h.answerOffer(c, domain.NotificationTypeOfferRejected, func(userID, offerID int64) (domain.Offer, error) {
+		return h.OfferService.Reject(c.Request().Context(), userID, offerID)
+	})
+}
+
+// CounterOffer answers an offer with another price, which the other party
+// can accept, reject or counter in turn.
+func (h *Handler) CounterOffer(c echo.Context) error {
+	price, err := getOfferPrice(c)
+	if err != nil {
+		return err
+	}
+	return h.answerOffer(c, domain.NotificationTypeOffer, func(userID, offerID int64) (domain.Offer, error) {
+		return h.OfferService.Counter(c.Request().Context(), userID, offerID, price)
+	})
+}
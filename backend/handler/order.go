@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/service"
+	"github.com/labstack/echo/v4"
+)
+
+type orderResponse struct {
+	ID        int64              `json:"id"`
+	ItemID    int32              `json:"item_id"`
+	ItemName  string             `json:"item_name"`
+	BuyerID   int64              `json:"buyer_id"`
+	SellerID  int64              `json:"seller_id"`
+	Price     int64              `json:"price"`
+	Status    domain.OrderStatus `json:"status"`
+	CreatedAt string             `json:"created_at"`
+	ShippedAt string             `json:"shipped_at"`
+	UpdatedAt string             `json:"updated_at"`
+	// Cancellation is the latest cancellation of the order, only in
+	// the detail of an order.
+	Cancellation *cancellationResponse `json:"cancellation,omitempty"`
+}
+
+type cancellationResponse struct {
+	ID          int64                     `json:"id"`
+	RequestedBy int64                     `json:"requested_by"`
+	Reason      string                    `json:"reason"`
+	Status      domain.CancellationStatus `json:"status"`
+	CreatedAt   string                    `json:"created_at"`
+	UpdatedAt   string                    `json:"updated_at"`
+}
+
+type cancellationRequest struct {
+	Reason string `json:"reason"`
+}
+
+func newOrderResponse(o domain.Order) orderResponse {
+	return orderResponse{
+		ID:        o.ID,
+		ItemID:    o.ItemID,
+		ItemName:  o.ItemName,
+		BuyerID:   o.BuyerID,
+		SellerID:  o.SellerID,
+		Price:     o.Price,
+		Status:    o.Status,
+		CreatedAt: o.CreatedAt,
+		ShippedAt: o.ShippedAt,
+		UpdatedAt: o.UpdatedAt,
+	}
+}
+
+func orderError(err error) error {
+	switch err {
+	case db.ErrOrderNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case service.ErrNotOrderParty, service.ErrWrongParty, db.ErrInvalidOrderStatus, db.ErrCancellationRequested, db.ErrCancellationNotRequested:
+		return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// GetOrders lists the orders of the user, newest first. The query parameter
+// "role" is "buyer" or "seller" to list only the purchases or the sales of
+// the user, and "status" lists only the orders in that status.
+func (h *Handler) GetOrders(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	limit, offset, err := getPagination(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	role := domain.OrderRole(c.QueryParam("role"))
+	switch role {
+	case "", domain.OrderRoleBuyer, domain.OrderRoleSeller:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid role: %s", role))
+	}
+	status := domain.OrderStatus(c.QueryParam("status"))
+	switch status {
+	case "", domain.OrderStatusPaid, domain.OrderStatusShipped, domain.OrderStatusReceived, domain.OrderStatusCompleted, domain.OrderStatusCancelled:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid status: %s", status))
+	}
+
+	total, err := h.OrderRepo.CountOrders(ctx, userID, role, status)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	orders, err := h.OrderRepo.GetOrders(ctx, userID, role, status, limit, offset)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	res := make([]orderResponse, 0, len(orders))
+	for _, o := range orders {
+		res = append(res, newOrderResponse(o))
+	}
+	c.Response().Header().Set(headerTotalCount, strconv.FormatInt(total, 10))
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) GetOrder(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	orderID, err := strconv.ParseInt(c.Param("orderID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid orderID type")
+	}
+
+	order, err := h.OrderService.GetOrder(c.Request().Context(), userID, orderID)
+	if err != nil {
+		return orderError(err)
+	}
+	res := newOrderResponse(order)
+
+	cancellation, err := h.CancellationRepo.GetLatestCancellation(c.Request().Context(), orderID)
+	switch err {
+	case nil:
+		res.Cancellation = &cancellationResponse{
+			ID:          cancellation.ID,
+			RequestedBy: cancellation.RequestedBy,
+			Reason:      cancellation.Reason,
+			Status:      cancellation.Status,
+			CreatedAt:   cancellation.CreatedAt,
+			UpdatedAt:   cancellation.UpdatedAt,
+		}
+	case db.ErrCancellationNotFound:
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// advanceOrder makes the transition t on the order of the orderID parameter
+// and tells the other party about it.
+func (h *Handler) advanceOrder(c echo.Context, t domain.OrderTransition) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	orderID, err := strconv.ParseInt(c.Param("orderID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid orderID type")
+	}
+
+	order, err := h.OrderService.Advance(ctx, userID, orderID, t)
+	if err != nil {
+		return orderError(err)
+	}
+	if err := h.AlertService.NotifyAdvanced(ctx, order, t); err != nil {
+		c.Logger().Errorf("failed to notify order %d: %s", order.ID, err)
+	}
+	if t.To == domain.OrderStatusReceived {
+		h.publishBalance(c, order.SellerID)
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// ShipOrder is called by the seller after sending the item.
+func (h *Handler) ShipOrder(c echo.Context) error {
+	return h.advanceOrder(c, domain.OrderShip)
+}
+
+// ReceiveOrder is called by the buyer after receiving the item, which
+// releases the money to the seller.
+func (h *Handler) ReceiveOrder(c echo.Context) error {
+	return h.advanceOrder(c, domain.OrderReceive)
+}
+
+// CompleteOrder is called by the seller to close a received order.
+func (h *Handler) CompleteOrder(c echo.Context) error {
+	return h.advanceOrder(c, domain.OrderComplete)
+}
+
+// getCancellationReason reads the reason of a cancellation from the request.
+func getCancellationReason(c echo.Context) (string, error) {
+	req := new(cancellationRequest)
+	if err := c.Bind(req); err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if utf8.RuneCountInString(reason) > domain.MaxCancellationReason {
+		return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("reason is longer than %d characters", domain.MaxCancellationReason))
+	}
+	return reason, nil
+}
+
+// notifyCancelled tells the parties of a cancelled order except userID about
+// it, and pushes their new balances.
+func (h *Handler) notifyCancelled(c echo.Context, order domain.Order, userID int64) {
+	if err := h.AlertService.NotifyParties(c.Request().Context(), order, domain.NotificationTypeOrderCancelled, userID); err != nil {
+		c.Logger().Errorf("failed to notify order %d: %s", order.ID, err)
+	}
+	h.publishBalance(c, order.BuyerID)
+	h.publishBalance(c, order.SellerID)
+}
+
+// RequestCancellation asks the other party of an order to cancel it. Orders
+// can be cancelled until they are received.
+func (h *Handler) RequestCancellation(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	orderID, err := strconv.ParseInt(c.Param("orderID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid orderID type")
+	}
+	reason, err := getCancellationReason(c)
+	if err != nil {
+		return err
+	}
+
+	order, err := h.OrderService.RequestCancellation(ctx, userID, orderID, reason)
+	if err != nil {
+		return orderError(err)
+	}
+	if err := h.AlertService.NotifyParties(ctx, order, domain.NotificationTypeCancelRequested, userID); err != nil {
+		c.Logger().Errorf("failed to notify order %d: %s", order.ID, err)
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+func (h *Handler) resolveCancellation(c echo.Context, approve bool) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	orderID, err := strconv.ParseInt(c.Param("orderID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid orderID type")
+	}
+
+	order, cancellation, err := h.OrderService.ResolveCancellation(ctx, userID, orderID, approve)
+	if err != nil {
+		return orderError(err)
+	}
+	if approve {
+		h.notifyCancelled(c, order, userID)
+	} else {
+		err := h.AlertService.Notify(ctx, []domain.Notification{{UserID: cancellation.RequestedBy, Type: domain.NotificationTypeCancelRejected, ItemID: order.ItemID}})
+		if err != nil {
+			c.Logger().Errorf("failed to notify order %d: %s", order.ID, err)
+		}
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
+
+// ApproveCancellation cancels the order the other party has asked to cancel.
+// The buyer is refunded, and the item is put on sale again, or back to draft
+// when it has been shipped.
+func (h *Handler) ApproveCancellation(c echo.Context) error {
+	return h.resolveCancellation(c, true)
+}
+
+// RejectCancellation keeps the order the other party has asked to cancel.
+func (h *Handler) RejectCancellation(c echo.Context) error {
+	return h.resolveCancellation(c, false)
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// newQueryContext returns the context of a GET request with the given query
+// string, and the recorder of its response.
+func newQueryContext(query string) (echo.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	return echo.New().NewContext(req, rec), rec
+}
+
+func TestGetPagination(t *testing.T) {
+	tests := []struct {
+		query  string
+		limit  int
+		offset int
+		ok     bool
+	}{
+		{"", defaultPageLimit, 0, true},
+		{"limit=5&offset=10", 5, 10, true},
+		{"limit=1000", maxPageLimit, 0, true},
+		{"limit=0", 0, 0, false},
+		{"limit=x", 0, 0, false},
+		{"offset=-1", 0, 0, false},
+		{"offset=x", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := newQueryContext(tt.query)
+			limit, offset, err := getPagination(c)
+			if (err == nil) != tt.ok || limit != tt.limit || offset != tt.offset {
+				t.Errorf("getPagination() = %d, %d, %v, want %d, %d and ok %t", limit, offset, err, tt.limit, tt.offset, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGetListOptions(t *testing.T) {
+	next := &db.ItemCursor{Sort: domain.ItemSortPriceAsc, Value: "300", ID: 42}
+	c, rec := newQueryContext("")
+	setPageHeaders(c, db.ItemPage{Total: 7, Next: next})
+	cursor := rec.Header().Get(headerNextCursor)
+	if cursor == "" || rec.Header().Get(headerTotalCount) != "7" {
+		t.Fatalf("page headers are %v", rec.Header())
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  db.ItemListOptions
+		err   bool
+	}{
+		{"default", "", db.ItemListOptions{Sort: domain.ItemSortNewest, Limit: defaultPageLimit}, false},
+		{"sort and limit", "sort=price_desc&limit=3", db.ItemListOptions{Sort: domain.ItemSortPriceDesc, Limit: 3}, false},
+		{"next page", "sort=price_asc&cursor=" + cursor, db.ItemListOptions{Sort: domain.ItemSortPriceAsc, Limit: defaultPageLimit, After: next}, false},
+		{"unknown sort", "sort=oldest", db.ItemListOptions{}, true},
+		{"invalid limit", "limit=-1", db.ItemListOptions{}, true},
+		{"cursor not base64", "cursor=%2A%2A", db.ItemListOptions{}, true},
+		{"cursor not json", "cursor=bm90IGpzb24", db.ItemListOptions{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newQueryContext(tt.query)
+			got, err := getListOptions(c, domain.ItemSortNewest)
+			if (err != nil) != tt.err {
+				t.Fatalf("getListOptions() returned %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getListOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	c, _ = newQueryContext("cursor=bm90IGpzb24")
+	if _, err := getListOptions(c, domain.ItemSortNewest); !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("invalid cursor returned %v", err)
+	}
+}
+
+func TestGetItemFilter(t *testing.T) {
+	rfc3339 := time.Date(2023, 6, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query string
+		want  db.ItemFilter
+		err   bool
+	}{
+		{"none", "", db.ItemFilter{}, false},
+		{"repeated and comma separated categories", "category_id=1,2&category_id=3", db.ItemFilter{CategoryIDs: []int64{1, 2, 3}}, false},
+		{"prices and seller", "min_price=100&max_price=500&seller_id=9", db.ItemFilter{MinPrice: 100, MaxPrice: 500, SellerID: 9}, false},
+		{"public statuses", "status=2,3&status=4", db.ItemFilter{Statuses: []domain.ItemStatus{domain.ItemStatusOnSale, domain.ItemStatusSoldOut, domain.ItemStatusReserved}}, false},
+		{"date", "created_after=2023-06-01", db.ItemFilter{CreatedAfter: "2023-06-01 00:00:00"}, false},
+		{"rfc 3339", "created_after=2023-06-01T12:30:00Z", db.ItemFilter{CreatedAfter: rfc3339.In(time.Local).Format(domain.TimestampLayout)}, false},
+		{"draft status", "status=1", db.ItemFilter{}, true},
+		{"invalid category", "category_id=1,x", db.ItemFilter{}, true},
+		{"negative price", "min_price=-1", db.ItemFilter{}, true},
+		{"invalid date", "created_after=yesterday", db.ItemFilter{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newQueryContext(tt.query)
+			got, err := getItemFilter(c)
+			if (err != nil) != tt.err {
+				t.Fatalf("getItemFilter() returned %v", err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getItemFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFacets(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+		err   bool
+	}{
+		{"", false, false},
+		{"facets=true", true, false},
+		{"facets=1", true, false},
+		{"facets=false", false, false},
+		{"facets=maybe", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := newQueryContext(tt.query)
+			got, err := getFacets(c)
+			if got != tt.want || (err != nil) != tt.err {
+				t.Errorf("getFacets() = %t, %v, want %t and error %t", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewSearchFacetsResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		facets db.ItemFacets
+		want   string
+	}{
+		{"nothing found", db.ItemFacets{}, `{"categories":[],"prices":[]}`},
+		{"categories and prices", db.ItemFacets{
+			Categories: []db.CategoryFacet{
+				{Category: domain.Category{ID: 1, Name: "fashion"}, Count: 2},
+				{Category: domain.Category{ID: 0, Name: db.UncategorizedName}, Count: 1},
+			},
+			Prices: []db.PriceFacet{{Min: 0, Max: 1000, Count: 2}, {Min: 1000, Count: 1}},
+		}, `{"categories":[{"id":1,"name":"fashion","count":2},{"id":0,"name":"uncategorized","count":1}],` +
+			`"prices":[{"min":0,"max":1000,"count":2},{"min":1000,"count":1}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(newSearchFacetsResponse(tt.facets))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("facets are %s, want %s", b, tt.want)
+			}
+		})
+	}
+}
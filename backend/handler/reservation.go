@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/service"
+	"github.com/labstack/echo/v4"
+)
+
+type reservationResponse struct {
+	ID        int64  `json:"id"`
+	ItemID    int32  `json:"item_id"`
+	Price     int64  `json:"price"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+func reservationError(err error) error {
+	switch err {
+	case service.ErrItemNotFound:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case service.ErrOwnItem, service.ErrNotReservationHolder, db.ErrItemNotOnSale, db.ErrItemReserved, db.ErrItemAuctioned, db.ErrInsufficientBalance, db.ErrReservationNotActive,
+		db.ErrReservationCooldown, db.ErrTooManyReservations:
+		return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// ReserveItem holds an item on sale for the user, who alone can purchase it
+// until the hold expires. The seller is notified.
+func (h *Handler) ReserveItem(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+
+	reservation, err := h.ReservationService.Reserve(ctx, userID, int32(itemID))
+	if err != nil {
+		return reservationError(err)
+	}
+	if item, err := h.ItemRepo.GetItem(ctx, reservation.ItemID); err != nil {
+		c.Logger().Errorf("failed to notify reservation of item %d: %s", reservation.ItemID, err)
+	} else {
+		err := h.AlertService.Notify(ctx, []domain.Notification{{UserID: item.UserID, Type: domain.NotificationTypeItemReserved, ItemID: item.ID}})
+		if err != nil {
+			c.Logger().Errorf("failed to notify reservation of item %d: %s", item.ID, err)
+		}
+	}
+	return c.JSON(http.StatusOK, reservationResponse{
+		ID:        reservation.ID,
+		ItemID:    reservation.ItemID,
+		Price:     reservation.Price,
+		ExpiresAt: reservation.ExpiresAt,
+	})
+}
+
+// ReleaseItem gives up the hold of the user on an item, which goes back on
+// sale.
+func (h *Handler) ReleaseItem(c echo.Context) error {
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	itemID, err := strconv.ParseInt(c.Param("itemID"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid itemID type")
+	}
+
+	if err := h.ReservationService.Release(c.Request().Context(), userID, int32(itemID)); err != nil {
+		return reservationError(err)
+	}
+	return c.JSON(http.StatusOK, "successful")
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// profileReviews is the number of recent reviews in a profile.
+const profileReviews = 10
+
+type reviewRequest struct {
+	Rating  domain.Rating `json:"rating"`
+	Comment string        `json:"comment"`
+}
+
+type addReviewResponse struct {
+	ID int64 `json:"id"`
+}
+
+type reviewResponse struct {
+	ID           int64            `json:"id"`
+	OrderID      int64            `json:"order_id"`
+	ItemID       int32            `json:"item_id"`
+	ItemName     string           `json:"item_name"`
+	ReviewerID   int64            `json:"reviewer_id"`
+	ReviewerName string           `json:"reviewer_name"`
+	ReviewerRole domain.OrderRole `json:"reviewer_role"`
+	Rating       domain.Rating    `json:"rating"`
+	Comment      string           `json:"comment"`
+	CreatedAt    string           `json:"created_at"`
+}
+
+type ratingsResponse struct {
+	Good   int64 `json:"good"`
+	Normal int64 `json:"normal"`
+	Bad    int64 `json:"bad"`
+}
+
+type profileResponse struct {
+	ID            int64            `json:"id"`
+	Name          string           `json:"name"`
+	Ratings       ratingsResponse  `json:"ratings"`
+	ReviewCount   int64            `json:"review_count"`
+	RecentReviews []reviewResponse `json:"recent_reviews"`
+}
+
+// AddReview rates the other party of a received order. Each party reviews
+// an order once.
+func (h *Handler) AddReview(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	orderID, err := strconv.ParseInt(c.Param("orderID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid orderID type")
+	}
+	req := new(reviewRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if !req.Rating.Valid() {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid rating: %s", req.Rating))
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if utf8.RuneCountInString(comment) > domain.MaxReviewComment {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("comment is longer than %d characters", domain.MaxReviewComment))
+	}
+
+	review, err := h.OrderService.Review(ctx, userID, orderID, req.Rating, comment)
+	if err == db.ErrAlreadyReviewed {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
+	}
+	if err != nil {
+		return orderError(err)
+	}
+	err = h.AlertService.Notify(ctx, []domain.Notification{{UserID: review.RevieweeID, Type: domain.NotificationTypeReviewed, ItemID: review.ItemID}})
+	if err != nil {
+		c.Logger().Errorf("failed to notify review %d: %s", review.ID, err)
+	}
+	return c.JSON(http.StatusOK, addReviewResponse{ID: review.ID})
+}
+
+// GetUserProfile shows the ratings of a user and their recent reviews to
+// anyone.
+func (h *Handler) GetUserProfile(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid userID type")
+	}
+	user, err := h.UserRepo.GetUser(ctx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	summary, err := h.ReviewRepo.GetRatingSummary(ctx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	reviews, err := h.ReviewRepo.GetReviews(ctx, userID, profileReviews, 0)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	res := profileResponse{
+		ID:            user.ID,
+		Name:          user.Name,
+		Ratings:       ratingsResponse{Good: summary.Good, Normal: summary.Normal, Bad: summary.Bad},
+		ReviewCount:   summary.Good + summary.Normal + summary.Bad,
+		RecentReviews: make([]reviewResponse, 0, len(reviews)),
+	}
+	for _, rv := range reviews {
+		res.RecentReviews = append(res.RecentReviews, reviewResponse{
+			ID:           rv.ID,
+			OrderID:      rv.OrderID,
+			ItemID:       rv.ItemID,
+			ItemName:     rv.ItemName,
+			ReviewerID:   rv.ReviewerID,
+			ReviewerName: rv.ReviewerName,
+			ReviewerRole: rv.ReviewerRole,
+			Rating:       rv.Rating,
+			Comment:      rv.Comment,
+			CreatedAt:    rv.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, res)
+}
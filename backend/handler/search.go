@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// searchResponse is the response of a search with facets=true.
+type searchResponse struct {
+	Items  []getItemResponse    `json:"items"`
+	Facets searchFacetsResponse `json:"facets"`
+}
+
+type searchFacetsResponse struct {
+	Categories []categoryFacetResponse `json:"categories"`
+	Prices     []priceFacetResponse    `json:"prices"`
+}
+
+type categoryFacetResponse struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type priceFacetResponse struct {
+	Min int64 `json:"min"`
+	// Max is exclusive and omitted for the last bucket.
+	Max   int64 `json:"max,omitempty"`
+	Count int64 `json:"count"`
+}
+
+// queryInts reads a query parameter that may be repeated or comma separated,
+// e.g. "category_id=1&category_id=2" or "category_id=1,2".
+func queryInts(c echo.Context, name string) ([]int64, error) {
+	var res []int64
+	for _, param := range c.QueryParams()[name] {
+		for _, v := range strings.Split(param, ",") {
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", name, v)
+			}
+			res = append(res, n)
+		}
+	}
+	return res, nil
+}
+
+func queryInt(c echo.Context, name string) (int64, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", name, v)
+	}
+	return n, nil
+}
+
+// getItemFilter reads the search filters "category_id", "min_price",
+// "max_price", "status", "seller_id" and "created_after", which is a date or
+// an RFC 3339 time.
+func getItemFilter(c echo.Context) (db.ItemFilter, error) {
+	var f db.ItemFilter
+	var err error
+	if f.CategoryIDs, err = queryInts(c, "category_id"); err != nil {
+		return f, err
+	}
+	if f.MinPrice, err = queryInt(c, "min_price"); err != nil {
+		return f, err
+	}
+	if f.MaxPrice, err = queryInt(c, "max_price"); err != nil {
+		return f, err
+	}
+	if f.SellerID, err = queryInt(c, "seller_id"); err != nil {
+		return f, err
+	}
+
+	statuses, err := queryInts(c, "status")
+	if err != nil {
+		return f, err
+	}
+	for _, status := range statuses {
+		if !domain.ItemStatus(status).Public() {
+			return f, fmt.Errorf("invalid status: %d", status)
+		}
+		f.Statuses = append(f.Statuses, domain.ItemStatus(status))
+	}
+
+	if v := c.QueryParam("created_after"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, v); err != nil {
+				return f, fmt.Errorf("invalid created_after: %s", v)
+			}
+		}
+		f.CreatedAfter = t.In(time.Local).Format(domain.TimestampLayout)
+	}
+	return f, nil
+}
+
+// getFacets reads the "facets" query parameter, which asks a search to count
+// its results by category and price as well.
+func getFacets(c echo.Context) (bool, error) {
+	v := c.QueryParam("facets")
+	if v == "" {
+		return false, nil
+	}
+	facets, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid facets: %s", v)
+	}
+	return facets, nil
+}
+
+// newSearchFacetsResponse lists every category and price bucket found, with
+// the items that have no category under id 0.
+func newSearchFacetsResponse(facets db.ItemFacets) searchFacetsResponse {
+	res := searchFacetsResponse{
+		Categories: make([]categoryFacetResponse, 0, len(facets.Categories)),
+		Prices:     make([]priceFacetResponse, 0, len(facets.Prices)),
+	}
+	for _, facet := range facets.Categories {
+		res.Categories = append(res.Categories, categoryFacetResponse{ID: facet.Category.ID, Name: facet.Category.Name, Count: facet.Count})
+	}
+	for _, facet := range facets.Prices {
+		res.Prices = append(res.Prices, priceFacetResponse{Min: facet.Min, Max: facet.Max, Count: facet.Count})
+	}
+	return res
+}
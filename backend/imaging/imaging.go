@@ -0,0 +1,194 @@
+// Package imaging validates uploaded item images and renders the smaller
+// renditions served to clients.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatGIF  Format = "gif"
+	FormatWebP Format = "webp"
+)
+
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Longest side in pixels of each rendition.
+const (
+	ThumbnailSize = 200
+	MediumSize    = 800
+)
+
+// maxPixels guards against images that are small on the wire but huge once
+// decoded.
+const maxPixels = 40_000_000
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format, use JPEG, PNG, GIF or WebP")
+	ErrTooLarge          = errors.New("image dimensions are too large")
+)
+
+// Sniff detects the format of data from its magic bytes.
+func Sniff(data []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return FormatJPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG, nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF, nil
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return FormatWebP, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+func decodeConfig(data []byte, f Format) (image.Config, error) {
+	r := bytes.NewReader(data)
+	switch f {
+	case FormatJPEG:
+		return jpeg.DecodeConfig(r)
+	case FormatPNG:
+		return png.DecodeConfig(r)
+	case FormatGIF:
+		return gif.DecodeConfig(r)
+	case FormatWebP:
+		return webp.DecodeConfig(r)
+	}
+	return image.Config{}, ErrUnsupportedFormat
+}
+
+func decode(data []byte, f Format) (image.Image, error) {
+	r := bytes.NewReader(data)
+	switch f {
+	case FormatJPEG:
+		return jpeg.Decode(r)
+	case FormatPNG:
+		return png.Decode(r)
+	case FormatGIF:
+		return gif.Decode(r)
+	case FormatWebP:
+		return webp.Decode(r)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+func encode(img image.Image, f Format) ([]byte, Format, error) {
+	var buf bytes.Buffer
+	var err error
+	switch f {
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case FormatGIF:
+		err = gif.Encode(&buf, img, nil)
+	default:
+		// there is no WebP encoder, so WebP is written as PNG
+		f = FormatPNG
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), f, err
+}
+
+// Sanitize validates an uploaded image, applies its EXIF orientation and
+// strips metadata such as EXIF and XMP that may leak the location or device
+// of the seller. Images without metadata are returned unchanged.
+func Sanitize(data []byte) ([]byte, Format, error) {
+	f, err := Sniff(data)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := decodeConfig(data, f)
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	stripped, exif, err := stripMetadata(data, f)
+	if err != nil {
+		return nil, "", err
+	}
+	orientation := exifOrientation(exif)
+	if orientation <= 1 {
+		return stripped, f, nil
+	}
+
+	// re-encoding drops all metadata as well
+	img, err := decode(data, f)
+	if err != nil {
+		return nil, "", err
+	}
+	return encode(orient(img, orientation), f)
+}
+
+// Resize scales data down so that its longest side is at most size pixels. It
+// returns data as is when it already fits. Opaque images are encoded as JPEG
+// and the others as PNG.
+func Resize(data []byte, size int) ([]byte, error) {
+	f, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := decodeConfig(data, f)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= size && cfg.Height <= size {
+		return data, nil
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, ErrTooLarge
+	}
+	img, err := decode(data, f)
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := cfg.Width, cfg.Height
+	if w >= h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	out := FormatPNG
+	if dst.Opaque() {
+		out = FormatJPEG
+	}
+	b, _, err := encode(dst, out)
+	return b, err
+}
+
+// ContentType returns the media type of an image, falling back to
+// application/octet-stream for data that is not a supported image.
+func ContentType(data []byte) string {
+	f, err := Sniff(data)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return f.ContentType()
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
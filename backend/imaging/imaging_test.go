@@ -0,0 +1,244 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func solid(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// exifTIFF is a little endian TIFF structure with only an Orientation tag.
+func exifTIFF(orientation uint16) []byte {
+	b := []byte("II*\x00\x08\x00\x00\x00")
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint16(b, 0x0112)
+	b = binary.LittleEndian.AppendUint16(b, 3)
+	b = binary.LittleEndian.AppendUint32(b, 1)
+	b = binary.LittleEndian.AppendUint16(b, orientation)
+	b = append(b, 0, 0)
+	return binary.LittleEndian.AppendUint32(b, 0)
+}
+
+// withJPEGSegment inserts a segment right after the start of image.
+func withJPEGSegment(data []byte, marker byte, payload []byte) []byte {
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xff, marker)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+	out = append(out, payload...)
+	return append(out, data[2:]...)
+}
+
+// withPNGChunk inserts a chunk right after the IHDR chunk.
+func withPNGChunk(data []byte, typ string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	const ihdrEnd = 8 + 12 + 13
+	out := append([]byte{}, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Format
+		err  error
+	}{
+		{"jpeg", []byte("\xff\xd8\xff\xe0rest"), FormatJPEG, nil},
+		{"png", []byte("\x89PNG\r\n\x1a\nrest"), FormatPNG, nil},
+		{"gif87a", []byte("GIF87arest"), FormatGIF, nil},
+		{"gif89a", []byte("GIF89arest"), FormatGIF, nil},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), FormatWebP, nil},
+		{"riff but not webp", []byte("RIFF\x00\x00\x00\x00WAVEfmt "), "", ErrUnsupportedFormat},
+		{"short webp", []byte("RIFF"), "", ErrUnsupportedFormat},
+		{"svg", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), "", ErrUnsupportedFormat},
+		{"empty", nil, "", ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sniff(tt.data)
+			if got != tt.want || err != tt.err {
+				t.Errorf("Sniff() = %q, %v, want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	wide := encodeJPEG(t, solid(16, 8, color.White))
+	plainPNG := encodePNG(t, solid(4, 4, color.White))
+	tests := []struct {
+		name      string
+		data      []byte
+		format    Format
+		w, h      int
+		unchanged bool
+	}{
+		{"jpeg without metadata", wide, FormatJPEG, 16, 8, true},
+		{"png without metadata", plainPNG, FormatPNG, 4, 4, true},
+		{"jpeg with exif", withJPEGSegment(wide, 0xe1, append([]byte("Exif\x00\x00"), exifTIFF(1)...)), FormatJPEG, 16, 8, false},
+		{"jpeg with comment", withJPEGSegment(wide, 0xfe, []byte("taken at home")), FormatJPEG, 16, 8, false},
+		{"jpeg rotated by exif", withJPEGSegment(wide, 0xe1, append([]byte("Exif\x00\x00"), exifTIFF(6)...)), FormatJPEG, 8, 16, false},
+		{"png with text", withPNGChunk(plainPNG, "tEXt", []byte("Comment\x00taken at home")), FormatPNG, 4, 4, false},
+		{"png rotated by exif", withPNGChunk(encodePNG(t, solid(6, 2, color.White)), "eXIf", exifTIFF(8)), FormatPNG, 2, 6, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, f, err := Sanitize(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f != tt.format {
+				t.Errorf("format is %q, want %q", f, tt.format)
+			}
+			if tt.unchanged && !bytes.Equal(got, tt.data) {
+				t.Error("image without metadata was changed")
+			}
+			for _, leak := range []string{"Exif", "eXIf", "tEXt", "taken at home"} {
+				if bytes.Contains(got, []byte(leak)) {
+					t.Errorf("sanitized image still contains %q", leak)
+				}
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.w || cfg.Height != tt.h {
+				t.Errorf("sanitized image is %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.w, tt.h)
+			}
+		})
+	}
+}
+
+func TestSanitizeRejects(t *testing.T) {
+	huge := encodePNG(t, solid(1, 1, color.White))
+	ihdr := huge[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:], 10000)
+	binary.BigEndian.PutUint32(ihdr[4:], 10000)
+	binary.BigEndian.PutUint32(huge[8+8+13:], crc32.ChecksumIEEE(huge[8+4:8+8+13]))
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"unsupported", []byte("BM not a supported image"), ErrUnsupportedFormat},
+		{"too many pixels", huge, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Sanitize(tt.data); err != tt.err {
+				t.Errorf("Sanitize() returned %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	a := color.NRGBA{R: 255, A: 255}
+	b := color.NRGBA{G: 255, A: 255}
+	c := color.NRGBA{B: 255, A: 255}
+	d := color.NRGBA{R: 255, G: 255, A: 255}
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	src.Set(0, 0, a)
+	src.Set(1, 0, b)
+	src.Set(0, 1, c)
+	src.Set(1, 1, d)
+
+	// the pixels of the result, row by row
+	tests := []struct {
+		orientation int
+		want        [4]color.NRGBA
+	}{
+		{1, [4]color.NRGBA{a, b, c, d}},
+		{2, [4]color.NRGBA{b, a, d, c}},
+		{3, [4]color.NRGBA{d, c, b, a}},
+		{4, [4]color.NRGBA{c, d, a, b}},
+		{5, [4]color.NRGBA{a, c, b, d}},
+		{6, [4]color.NRGBA{c, a, d, b}},
+		{7, [4]color.NRGBA{d, b, c, a}},
+		{8, [4]color.NRGBA{b, d, a, c}},
+	}
+	for _, tt := range tests {
+		got := orient(src, tt.orientation).(*image.NRGBA)
+		for i, want := range tt.want {
+			if px := got.NRGBAAt(i%2, i/2); px != want {
+				t.Errorf("orientation %d: pixel %d is %v, want %v", tt.orientation, i, px, want)
+			}
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 400, 100))
+	tests := []struct {
+		name      string
+		data      []byte
+		size      int
+		format    Format
+		w, h      int
+		unchanged bool
+	}{
+		{"fits already", encodePNG(t, solid(100, 50, color.White)), 200, FormatPNG, 100, 50, true},
+		{"wide", encodePNG(t, solid(400, 200, color.White)), 200, FormatJPEG, 200, 100, false},
+		{"tall", encodeJPEG(t, solid(100, 1000, color.White)), 200, FormatJPEG, 20, 200, false},
+		{"thin", encodePNG(t, solid(1000, 1, color.White)), 200, FormatJPEG, 200, 1, false},
+		{"transparent stays png", encodePNG(t, transparent), 200, FormatPNG, 200, 50, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resize(tt.data, tt.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.unchanged && !bytes.Equal(got, tt.data) {
+				t.Error("image that fits was changed")
+			}
+			if f, _ := Sniff(got); f != tt.format {
+				t.Errorf("format is %q, want %q", f, tt.format)
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.w || cfg.Height != tt.h {
+				t.Errorf("resized image is %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.w, tt.h)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+)
+
+var errMalformed = errors.New("malformed image")
+
+// stripMetadata removes metadata from data without re-encoding the pixels. It
+// also returns the EXIF payload, a TIFF structure, if there was one.
+func stripMetadata(data []byte, f Format) ([]byte, []byte, error) {
+	switch f {
+	case FormatJPEG:
+		return stripJPEG(data)
+	case FormatPNG:
+		return stripPNG(data)
+	case FormatWebP:
+		return stripWebP(data)
+	}
+	// GIF can not carry EXIF
+	return data, nil, nil
+}
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// stripJPEG drops the APP1 (EXIF, XMP) and APP13 (IPTC) segments and
+// comments. The JFIF, ICC profile and Adobe segments are needed to render
+// the image and are kept.
+func stripJPEG(data []byte) ([]byte, []byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	var exif []byte
+
+	i := 2
+	for {
+		if i+4 > len(data) || data[i] != 0xff {
+			return nil, nil, errMalformed
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			// fill byte
+			i++
+			continue
+		}
+		if marker == 0xda {
+			// the entropy coded data follows the start of scan, keep it all
+			out = append(out, data[i:]...)
+			return out, exif, nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, nil, errMalformed
+		}
+		segment := data[i+4 : end]
+
+		switch marker {
+		case 0xe1:
+			if exif == nil && bytes.HasPrefix(segment, exifHeader) {
+				exif = segment[len(exifHeader):]
+			}
+		case 0xed, 0xfe:
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true}
+
+func stripPNG(data []byte) ([]byte, []byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:8]...)
+	var exif []byte
+
+	for i := 8; i < len(data); {
+		if i+12 > len(data) {
+			return nil, nil, errMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		typ := string(data[i+4 : i+8])
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, nil, errMalformed
+		}
+
+		if typ == "eXIf" {
+			exif = data[i+8 : i+8+length]
+		}
+		if !pngMetadataChunks[typ] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, exif, nil
+}
+
+// VP8X flags telling that EXIF and XMP chunks are present
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+func stripWebP(data []byte) ([]byte, []byte, error) {
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	var exif []byte
+
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, nil, errMalformed
+		}
+		typ := string(data[i : i+4])
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + length + length%2
+		if length < 0 || end > len(data) {
+			return nil, nil, errMalformed
+		}
+
+		switch typ {
+		case "EXIF":
+			exif = bytes.TrimPrefix(data[i+8:i+8+length], exifHeader)
+		case "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, data[i:end]...)
+			if length > 0 {
+				out[start+8] &^= webpFlagEXIF | webpFlagXMP
+			}
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, exif, nil
+}
+
+// exifOrientation reads the Orientation tag from the first IFD of a TIFF
+// structure. It returns 0 when there is none.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) || ifd < 0 {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+	return 0
+}
+
+// orient transforms img so that it is displayed upright for the given EXIF
+// orientation.
+func orient(img image.Image, orientation int) image.Image {
+	b := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counterclockwise
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
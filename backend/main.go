@@ -7,9 +7,11 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/blobstore"
 	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
 	"github.com/kotapiku/mercari-build-hackathon-2023/backend/handler"
 	"github.com/kotapiku/mercari-build-hackathon-2023/backend/service"
@@ -24,6 +26,12 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrate(context.Background(), os.Args[2:]))
+		}
+	}
 	os.Exit(run(context.Background()))
 }
 
@@ -49,8 +57,9 @@ func run(ctx context.Context) int {
 		frontURL = "http://localhost:3000"
 	}
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{frontURL},
-		AllowMethods: []string{"GET", "PUT", "DELETE", "OPTIONS", "POST"},
+		AllowOrigins:  []string{frontURL},
+		AllowMethods:  []string{"GET", "PUT", "DELETE", "OPTIONS", "POST"},
+		ExposeHeaders: handler.PageHeaders,
 	}))
 	e.Use(middleware.BodyLimit("5M"))
 
@@ -70,11 +79,115 @@ func run(ctx context.Context) int {
 	}
 	defer sqlDB.Close()
 
+	mismatches, err := db.NewLedgerRepository(sqlDB).GetMismatches(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to reconcile balances: %s\n", err)
+		return exitError
+	}
+	for _, m := range mismatches {
+		fmt.Fprintf(os.Stderr, "balance mismatch: user %d has %d but ledger says %d\n", m.UserID, m.Balance, m.LedgerBalance)
+	}
+
+	imageDir := os.Getenv("IMAGE_DIR")
+	if imageDir == "" {
+		imageDir = "images"
+	}
+	imageStore, err := blobstore.NewLocalStore(imageDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prepare image store: %s\n", err)
+		return exitError
+	}
+	if _, err := db.MoveItemImages(ctx, sqlDB, imageStore); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to move item images: %s\n", err)
+		return exitError
+	}
+
+	releaseAfter := service.DefaultReleaseAfter
+	if v := os.Getenv("ESCROW_RELEASE_AFTER"); v != "" {
+		if releaseAfter, err = time.ParseDuration(v); err != nil || releaseAfter <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid ESCROW_RELEASE_AFTER: %s\n", v)
+			return exitError
+		}
+	}
+
+	shipWithin := service.DefaultShipWithin
+	if v := os.Getenv("ESCROW_SHIP_WITHIN"); v != "" {
+		if shipWithin, err = time.ParseDuration(v); err != nil || shipWithin <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid ESCROW_SHIP_WITHIN: %s\n", v)
+			return exitError
+		}
+	}
+
+	offerHold := service.DefaultOfferHold
+	if v := os.Getenv("OFFER_HOLD"); v != "" {
+		if offerHold, err = time.ParseDuration(v); err != nil || offerHold <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid OFFER_HOLD: %s\n", v)
+			return exitError
+		}
+	}
+
+	reservationHold := service.DefaultReservationHold
+	if v := os.Getenv("RESERVATION_HOLD"); v != "" {
+		if reservationHold, err = time.ParseDuration(v); err != nil || reservationHold <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid RESERVATION_HOLD: %s\n", v)
+			return exitError
+		}
+	}
+
+	reservationCooldown := service.DefaultReservationCooldown
+	if v := os.Getenv("RESERVATION_COOLDOWN"); v != "" {
+		if reservationCooldown, err = time.ParseDuration(v); err != nil || reservationCooldown < 0 {
+			fmt.Fprintf(os.Stderr, "invalid RESERVATION_COOLDOWN: %s\n", v)
+			return exitError
+		}
+	}
+
+	maxReservations := service.DefaultMaxReservations
+	if v := os.Getenv("RESERVATION_MAX_HOLDS"); v != "" {
+		if maxReservations, err = strconv.Atoi(v); err != nil || maxReservations < 0 {
+			fmt.Fprintf(os.Stderr, "invalid RESERVATION_MAX_HOLDS: %s\n", v)
+			return exitError
+		}
+	}
+
+	snipeWindow := service.DefaultSnipeWindow
+	if v := os.Getenv("AUCTION_SNIPE_WINDOW"); v != "" {
+		if snipeWindow, err = time.ParseDuration(v); err != nil || snipeWindow < 0 {
+			fmt.Fprintf(os.Stderr, "invalid AUCTION_SNIPE_WINDOW: %s\n", v)
+			return exitError
+		}
+	}
+
+	hub := service.NewHub()
+	alertService := service.NewAlertService(sqlDB, hub)
+	reservationService := service.NewReservationService(sqlDB, alertService, reservationHold, reservationCooldown, maxReservations)
+	auctionService := service.NewAuctionService(sqlDB, alertService, snipeWindow)
 	h := handler.Handler{
-		DB:           sqlDB,
-		UserRepo:     db.NewUserRepository(sqlDB),
-		ItemRepo:     db.NewItemRepository(sqlDB),
-		LoginService: service.NewLoginService(sqlDB),
+		DB:               sqlDB,
+		UserRepo:         db.NewUserRepository(sqlDB),
+		ItemRepo:         db.NewItemRepository(sqlDB),
+		TradeRepo:        db.NewTradeRepository(sqlDB),
+		LedgerRepo:       db.NewLedgerRepository(sqlDB),
+		ItemImageRepo:    db.NewItemImageRepository(sqlDB),
+		ImageStore:       imageStore,
+		LoginService:     service.NewLoginService(sqlDB),
+		PurchaseService:  service.NewPurchaseService(sqlDB),
+		SavedSearchRepo:  db.NewSavedSearchRepository(sqlDB),
+		NotificationRepo: db.NewNotificationRepository(sqlDB),
+		AlertService:     alertService,
+		LikeRepo:         db.NewLikeRepository(sqlDB),
+		MessageRepo:      db.NewMessageRepository(sqlDB),
+		Hub:              hub,
+		OrderRepo:        db.NewOrderRepository(sqlDB),
+		CancellationRepo: db.NewCancellationRepository(sqlDB),
+		ReviewRepo:       db.NewReviewRepository(sqlDB),
+		OrderService:     service.NewOrderService(sqlDB),
+		OfferRepo:        db.NewOfferRepository(sqlDB),
+		OfferService:     service.NewOfferService(sqlDB, offerHold),
+
+		ReservationService: reservationService,
+		AuctionRepo:        db.NewAuctionRepository(sqlDB),
+		AuctionService:     auctionService,
 	}
 
 	// Routes
@@ -85,7 +198,13 @@ func run(ctx context.Context) int {
 	e.GET("/items_all", h.GetOnSaleSoldOutItems)
 	e.GET("/items/:itemID", h.GetItem)
 	e.GET("/items/:itemID/image", h.GetImage)
+	e.GET("/items/:itemID/images", h.GetItemImages)
+	e.GET("/items/:itemID/images/:imageID", h.GetItemImage)
 	e.GET("/items/categories", h.GetCategories)
+	e.GET("/items/:itemID/comments", h.GetComments)
+	e.GET("/items/:itemID/auction", h.GetAuction)
+	e.GET("/items/:itemID/bids", h.GetBids)
+	e.GET("/users/:userID/profile", h.GetUserProfile)
 	e.POST("/register", h.Register)
 	e.POST("/login", h.Login)
 	e.POST("/login_name", h.LoginByName)
@@ -99,12 +218,89 @@ func run(ctx context.Context) int {
 	l.GET("/users/:userID/items", h.GetUserItems)
 	l.POST("/items", h.AddItem)
 	l.PUT("/items/:itemID", h.EditItem)
+	l.DELETE("/items/:itemID", h.DeleteItem)
+	l.GET("/items/:itemID/history", h.GetItemHistory)
+	l.POST("/items/:itemID/unlist", h.UnlistItem)
+	l.POST("/items/:itemID/pause", h.PauseItem)
+	l.POST("/items/:itemID/unpause", h.UnpauseItem)
+	l.POST("/items/:itemID/images", h.AddItemImages)
+	l.PUT("/items/:itemID/images", h.ReorderItemImages)
+	l.PUT("/items/:itemID/images/:imageID/cover", h.SetCoverImage)
+	l.DELETE("/items/:itemID/images/:imageID", h.DeleteItemImage)
 	l.POST("/sell", h.Sell)
 	l.POST("/purchase/:itemID", h.Purchase)
+	l.POST("/items/:itemID/reserve", h.ReserveItem)
+	l.DELETE("/items/:itemID/reserve", h.ReleaseItem)
+	l.POST("/items/:itemID/auction", h.StartAuction)
+	l.POST("/items/:itemID/bids", h.PlaceBid)
 	l.GET("/balance", h.GetBalance)
 	l.POST("/balance", h.AddBalance)
+	l.GET("/balance/history", h.GetBalanceHistory)
+	l.POST("/saved_searches", h.AddSavedSearch)
+	l.GET("/saved_searches", h.GetSavedSearches)
+	l.DELETE("/saved_searches/:searchID", h.DeleteSavedSearch)
+	l.GET("/notifications", h.GetNotifications)
+	l.POST("/notifications/read", h.ReadNotifications)
+	l.POST("/items/:itemID/like", h.LikeItem)
+	l.DELETE("/items/:itemID/like", h.UnlikeItem)
+	l.GET("/users/me/likes", h.GetMyLikes)
+	l.POST("/items/:itemID/comments", h.AddComment)
+	l.POST("/items/:itemID/comments/read", h.ReadComments)
+	l.GET("/items/:itemID/messages", h.GetMessages)
+	l.POST("/items/:itemID/messages", h.AddMessage)
+	l.POST("/items/:itemID/messages/read", h.ReadMessages)
+	l.GET("/orders", h.GetOrders)
+	l.GET("/orders/:orderID", h.GetOrder)
+	l.POST("/orders/:orderID/ship", h.ShipOrder)
+	l.POST("/orders/:orderID/receive", h.ReceiveOrder)
+	l.POST("/orders/:orderID/complete", h.CompleteOrder)
+	l.POST("/orders/:orderID/cancel", h.RequestCancellation)
+	l.POST("/orders/:orderID/cancel/approve", h.ApproveCancellation)
+	l.POST("/orders/:orderID/cancel/reject", h.RejectCancellation)
+	l.POST("/orders/:orderID/review", h.AddReview)
+	l.POST("/items/:itemID/offers", h.MakeOffer)
+	l.POST("/events/ticket", h.IssueStreamTicket)
+	l.GET("/offers", h.GetOffers)
+	l.GET("/offers/:offerID", h.GetOffer)
+	l.POST("/offers/:offerID/accept", h.AcceptOffer)
+	l.POST("/offers/:offerID/reject", h.RejectOffer)
+	l.POST("/offers/:offerID/counter", h.CounterOffer)
+
+	// Admins only
+	a := l.Group("/admin", h.AdminOnly)
+	a.POST("/orders/:orderID/refund", h.ForceRefund)
 	e.GET("/items", h.GetOnSaleItems)
 
+	// EventSource can not set headers, so the stream is opened with a
+	// single-use ticket instead of the token.
+	e.GET("/events", h.Events)
+
+	// Background jobs
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	escrowService := service.NewEscrowService(sqlDB, alertService, releaseAfter, shipWithin)
+	go runEvery(jobCtx, e.Logger, time.Minute, "release escrow", func(ctx context.Context) error {
+		_, err := escrowService.ReleaseExpired(ctx)
+		return err
+	})
+	go runEvery(jobCtx, e.Logger, time.Minute, "refund unshipped orders", func(ctx context.Context) error {
+		_, err := escrowService.RefundUnshipped(ctx)
+		return err
+	})
+	go runEvery(jobCtx, e.Logger, time.Minute, "release reservations", func(ctx context.Context) error {
+		_, err := reservationService.ReleaseExpired(ctx)
+		return err
+	})
+	go runEvery(jobCtx, e.Logger, time.Minute, "close auctions", func(ctx context.Context) error {
+		_, err := auctionService.CloseEnded(ctx)
+		return err
+	})
+	imageService := service.NewImageService(sqlDB, imageStore, service.DefaultImageSweepAfter)
+	go runEvery(jobCtx, e.Logger, time.Minute, "sweep deleted images", func(ctx context.Context) error {
+		_, err := imageService.SweepDeleted(ctx)
+		return err
+	})
+
 	// Start server
 	go func() {
 		if err := e.Start(":9000"); err != nil && err != http.ErrServerClosed {
@@ -117,6 +313,8 @@ func run(ctx context.Context) int {
 	<-quit
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	stopJobs()
+	hub.Close()
 	if err := e.Shutdown(ctx); err != nil {
 		e.Logger.Fatal(err)
 	}
@@ -124,13 +322,30 @@ func run(ctx context.Context) int {
 	return exitOK
 }
 
+// runEvery calls job every interval until ctx is done, and logs its errors.
+func runEvery(ctx context.Context, logger echo.Logger, interval time.Duration, name string, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job(ctx); err != nil {
+				logger.Errorf("failed to %s: %s", name, err)
+			}
+		}
+	}
+}
+
 func logFormat() string {
 	// Customize freely: https://echo.labstack.com/guide/customization/
 	var format string
 	format += "time:${time_rfc3339}\t"
 	format += "status:${status}\t"
 	format += "method:${method}\t"
-	format += "uri:${uri}\t"
+	// the path leaves out the query, which may carry stream tickets
+	format += "uri:${path}\t"
 	format += "latency:${latency_human}\t"
 	format += "error:${error}\t"
 	format += "\n"
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up         apply all pending migrations
+  down [N]   revert the last N applied migrations (default 1)
+  status     show applied and pending migrations
+`
+
+func runMigrate(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return exitError
+	}
+
+	sqlDB, err := db.OpenDB(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open DB: %s\n", err)
+		return exitError
+	}
+	defer sqlDB.Close()
+
+	switch args[0] {
+	case "up":
+		migrations, err := db.MigrateUp(ctx, sqlDB)
+		for _, m := range migrations {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return exitError
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				fmt.Fprintf(os.Stderr, "invalid number of steps: %s\n", args[1])
+				return exitError
+			}
+		}
+		migrations, err := db.MigrateDown(ctx, sqlDB, steps)
+		for _, m := range migrations {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return exitError
+		}
+	case "status":
+		statuses, err := db.GetMigrationStatus(ctx, sqlDB)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return exitError
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt
+			}
+			if st.Modified {
+				state += " (modified)"
+			}
+			fmt.Printf("%04d_%-30s %s\n", st.Version, st.Name, state)
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/textsearch"
+)
+
+type AlertService struct {
+	ItemRepo         db.ItemRepository
+	SavedSearchRepo  db.SavedSearchRepository
+	NotificationRepo db.NotificationRepository
+	LikeRepo         db.LikeRepository
+	UserRepo         db.UserRepository
+	OrderRepo        db.OrderRepository
+	Hub              *Hub
+}
+
+func NewAlertService(sqlDB *db.DB, hub *Hub) AlertService {
+	return AlertService{
+		ItemRepo:         db.NewItemRepository(sqlDB),
+		SavedSearchRepo:  db.NewSavedSearchRepository(sqlDB),
+		NotificationRepo: db.NewNotificationRepository(sqlDB),
+		LikeRepo:         db.NewLikeRepository(sqlDB),
+		UserRepo:         db.NewUserRepository(sqlDB),
+		OrderRepo:        db.NewOrderRepository(sqlDB),
+		Hub:              hub,
+	}
+}
+
+// Notify adds the notifications to the inboxes of their users and pushes
+// them to the users' streams.
+func (s AlertService) Notify(ctx context.Context, notifications []domain.Notification) error {
+	if err := s.NotificationRepo.AddNotifications(ctx, notifications); err != nil {
+		return err
+	}
+	for _, n := range notifications {
+		s.Hub.Publish(n.UserID, NotificationEvent(n))
+	}
+	return nil
+}
+
+// NotifyListed notifies the users whose saved searches match item, which has
+// just been put on sale. A user is notified once per item however many of
+// their searches match.
+func (s AlertService) NotifyListed(ctx context.Context, item domain.Item) error {
+	searches, err := s.SavedSearchRepo.GetSavedSearchCandidates(ctx, item)
+	if err != nil || len(searches) == 0 {
+		return err
+	}
+	category, err := s.ItemRepo.GetCategory(ctx, item.CategoryID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	notified := map[int64]bool{}
+	var notifications []domain.Notification
+	for _, search := range searches {
+		if notified[search.UserID] || !matchesSearch(search, item, category.Name) {
+			continue
+		}
+		notified[search.UserID] = true
+		notifications = append(notifications, domain.Notification{
+			UserID:        search.UserID,
+			Type:          domain.NotificationTypeSavedSearch,
+			ItemID:        item.ID,
+			SavedSearchID: search.ID,
+		})
+	}
+	return s.Notify(ctx, notifications)
+}
+
+// NotifyPurchased notifies the seller of an item that it has been purchased,
+// and the users who like it that it is sold.
+func (s AlertService) NotifyPurchased(ctx context.Context, item domain.Item, buyerID int64) error {
+	err := s.Notify(ctx, []domain.Notification{{UserID: item.UserID, Type: domain.NotificationTypeItemSold, ItemID: item.ID}})
+	if err != nil {
+		return err
+	}
+	return s.NotifyWatchers(ctx, item.ID, domain.NotificationTypeSold, buyerID)
+}
+
+// orderNotifications are the notifications about each status of an order.
+var orderNotifications = map[domain.OrderStatus]domain.NotificationType{
+	domain.OrderStatusShipped:   domain.NotificationTypeOrderShipped,
+	domain.OrderStatusReceived:  domain.NotificationTypeOrderReceived,
+	domain.OrderStatusCompleted: domain.NotificationTypeOrderCompleted,
+}
+
+// NotifyAdvanced tells the other party of an order that the transition t has
+// been made on it, or both parties when the server made it.
+func (s AlertService) NotifyAdvanced(ctx context.Context, order domain.Order, t domain.OrderTransition) error {
+	notificationType, ok := orderNotifications[t.To]
+	if !ok {
+		return nil
+	}
+	var actorID int64
+	switch t.By {
+	case domain.OrderRoleBuyer:
+		actorID = order.BuyerID
+	case domain.OrderRoleSeller:
+		actorID = order.SellerID
+	}
+	return s.NotifyParties(ctx, order, notificationType, actorID)
+}
+
+// NotifyParties notifies the buyer and the seller of an order, except the
+// user who caused the notification.
+func (s AlertService) NotifyParties(ctx context.Context, order domain.Order, notificationType domain.NotificationType, exceptUserID int64) error {
+	var notifications []domain.Notification
+	for _, userID := range []int64{order.BuyerID, order.SellerID} {
+		if userID != exceptUserID {
+			notifications = append(notifications, domain.Notification{UserID: userID, Type: notificationType, ItemID: order.ItemID})
+		}
+	}
+	return s.Notify(ctx, notifications)
+}
+
+// PublishBalance pushes the current balance of the user to their streams.
+func (s AlertService) PublishBalance(ctx context.Context, userID int64) error {
+	user, err := s.UserRepo.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	pending, err := s.OrderRepo.GetHeldAmount(ctx, userID)
+	if err != nil {
+		return err
+	}
+	s.Hub.Publish(userID, Event{Type: EventBalance, Data: BalanceEvent{Balance: user.Balance, Pending: pending}})
+	return nil
+}
+
+// NotifyWatchers notifies the users who like the item, except the one who
+// caused the notification, e.g. the buyer of the item.
+func (s AlertService) NotifyWatchers(ctx context.Context, itemID int32, notificationType domain.NotificationType, exceptUserID int64) error {
+	watchers, err := s.LikeRepo.GetWatchers(ctx, itemID)
+	if err != nil {
+		return err
+	}
+	var notifications []domain.Notification
+	for _, userID := range watchers {
+		if userID == exceptUserID {
+			continue
+		}
+		notifications = append(notifications, domain.Notification{UserID: userID, Type: notificationType, ItemID: itemID})
+	}
+	return s.Notify(ctx, notifications)
+}
+
+// matchesSearch checks the filters GetSavedSearchCandidates leaves to the
+// caller.
+func matchesSearch(search domain.SavedSearch, item domain.Item, categoryName string) bool {
+	if len(search.CategoryIDs) > 0 {
+		found := false
+		for _, id := range search.CategoryIDs {
+			found = found || id == item.CategoryID
+		}
+		if !found {
+			return false
+		}
+	}
+	return textsearch.Match(search.Query, item.Name, item.Description, categoryName)
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// DefaultSnipeWindow is how long before its end a bid extends an auction, to
+// as long after the bid.
+const DefaultSnipeWindow = 5 * time.Minute
+
+// AuctionService runs auctions, and closes those that have ended.
+type AuctionService struct {
+	ItemRepo     db.ItemRepository
+	AuctionRepo  db.AuctionRepository
+	TradeRepo    db.TradeRepository
+	AlertService AlertService
+	SnipeWindow  time.Duration
+}
+
+var (
+	ErrNotItemSeller  = errors.New("can not sell other's item")
+	ErrInvalidEndTime = errors.New("invalid end time")
+)
+
+func NewAuctionService(sqlDB *db.DB, alertService AlertService, snipeWindow time.Duration) AuctionService {
+	return AuctionService{
+		ItemRepo:     db.NewItemRepository(sqlDB),
+		AuctionRepo:  db.NewAuctionRepository(sqlDB),
+		TradeRepo:    db.NewTradeRepository(sqlDB),
+		AlertService: alertService,
+		SnipeWindow:  snipeWindow,
+	}
+}
+
+// Start puts a draft item of the seller on sale by auction until endsAt,
+// which is in domain.TimestampLayout, and returns the item on sale.
+func (s AuctionService) Start(ctx context.Context, sellerID int64, itemID int32, startPrice, minIncrement int64, endsAt string) (domain.Item, error) {
+	item, err := s.ItemRepo.GetItem(ctx, itemID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Item{}, ErrItemNotFound
+		}
+		return domain.Item{}, err
+	}
+	if item.UserID != sellerID {
+		return domain.Item{}, ErrNotItemSeller
+	}
+	end, err := time.ParseInLocation(domain.TimestampLayout, endsAt, time.Local)
+	if err != nil || !end.After(time.Now()) || end.After(time.Now().Add(domain.MaxAuctionDuration)) {
+		return domain.Item{}, ErrInvalidEndTime
+	}
+
+	_, err = s.AuctionRepo.StartAuction(ctx, domain.Auction{
+		ItemID:       itemID,
+		SellerID:     sellerID,
+		StartPrice:   startPrice,
+		MinIncrement: minIncrement,
+		EndsAt:       endsAt,
+	})
+	if err != nil {
+		return domain.Item{}, err
+	}
+	item.Status = domain.ItemStatusOnSale
+	item.Price = startPrice
+	return item, nil
+}
+
+// GetOpenAuction returns the auction of an item that has not been closed.
+func (s AuctionService) GetOpenAuction(ctx context.Context, itemID int32) (domain.Auction, error) {
+	auction, err := s.AuctionRepo.GetAuction(ctx, itemID)
+	if err != nil {
+		return domain.Auction{}, err
+	}
+	if auction.Status != domain.AuctionStatusOpen {
+		return domain.Auction{}, db.ErrAuctionClosed
+	}
+	return auction, nil
+}
+
+// Bid places a bid of the user on the auction of an item, and returns the
+// bid it has outbid, if any.
+func (s AuctionService) Bid(ctx context.Context, bidderID int64, itemID int32, amount int64) (domain.Bid, domain.Bid, error) {
+	auction, err := s.GetOpenAuction(ctx, itemID)
+	if err != nil {
+		return domain.Bid{}, domain.Bid{}, err
+	}
+	if auction.SellerID == bidderID {
+		return domain.Bid{}, domain.Bid{}, ErrOwnItem
+	}
+	extendTo := time.Now().Add(s.SnipeWindow).Format(domain.TimestampLayout)
+	return s.TradeRepo.PlaceBid(ctx, auction.ID, bidderID, amount, extendTo)
+}
+
+// CloseEnded closes the auctions that have ended, tells the parties about the
+// result, and returns how many it closed. An auction that fails to close or
+// to be notified does not stop the others; the errors are returned together
+// at the end.
+func (s AuctionService) CloseEnded(ctx context.Context) (int, error) {
+	auctions, err := s.AuctionRepo.GetEndedAuctions(ctx, time.Now().Format(domain.TimestampLayout))
+	if err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	var errs jobErrors
+	for _, auction := range auctions {
+		winner, _, err := s.TradeRepo.CloseAuction(ctx, auction.ID)
+		if err == db.ErrAuctionNotEnded {
+			// extended by a last bid in the meantime
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("auction %d: %w", auction.ID, err))
+			continue
+		}
+		closed++
+		if err := s.notifyClosed(ctx, auction, winner); err != nil {
+			errs = append(errs, fmt.Errorf("notify auction %d: %w", auction.ID, err))
+		}
+	}
+	return closed, errs.err()
+}
+
+// notifyClosed tells the parties of a closed auction about its winner, who
+// is empty when nobody bid.
+func (s AuctionService) notifyClosed(ctx context.Context, auction domain.Auction, winner domain.Bid) error {
+	if winner.ID == 0 {
+		return s.AlertService.Notify(ctx, []domain.Notification{{UserID: auction.SellerID, Type: domain.NotificationTypeAuctionUnsold, ItemID: auction.ItemID}})
+	}
+	item, err := s.ItemRepo.GetItem(ctx, auction.ItemID)
+	if err != nil {
+		return err
+	}
+	if err := s.AlertService.NotifyPurchased(ctx, item, winner.BidderID); err != nil {
+		return err
+	}
+	err = s.AlertService.Notify(ctx, []domain.Notification{{UserID: winner.BidderID, Type: domain.NotificationTypeAuctionWon, ItemID: auction.ItemID}})
+	if err != nil {
+		return err
+	}
+	return s.AlertService.PublishBalance(ctx, auction.SellerID)
+}
@@ -2,7 +2,6 @@ package service
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"os"
 	"time"
@@ -26,7 +25,7 @@ var (
 	ErrMismatchPassword = errors.New("mismatch password")
 )
 
-func NewLoginService(sqlDB *sql.DB) LoginService {
+func NewLoginService(sqlDB *db.DB) LoginService {
 	return LoginService{UserRepo: db.NewUserRepository(sqlDB)}
 }
 
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+const (
+	// DefaultReleaseAfter is how long the money of a shipped order is held
+	// when the buyer does not confirm receipt.
+	DefaultReleaseAfter = 72 * time.Hour
+	// DefaultShipWithin is how long the seller has to ship a paid order
+	// before it is cancelled and the buyer refunded.
+	DefaultShipWithin = 7 * 24 * time.Hour
+)
+
+// EscrowService releases the money of shipped orders whose buyers have not
+// confirmed receipt in time, and refunds the buyers of orders their sellers
+// have not shipped in time, so that no money is held forever.
+type EscrowService struct {
+	OrderRepo    db.OrderRepository
+	TradeRepo    db.TradeRepository
+	AlertService AlertService
+	ReleaseAfter time.Duration
+	ShipWithin   time.Duration
+}
+
+func NewEscrowService(sqlDB *db.DB, alertService AlertService, releaseAfter, shipWithin time.Duration) EscrowService {
+	return EscrowService{
+		OrderRepo:    db.NewOrderRepository(sqlDB),
+		TradeRepo:    db.NewTradeRepository(sqlDB),
+		AlertService: alertService,
+		ReleaseAfter: releaseAfter,
+		ShipWithin:   shipWithin,
+	}
+}
+
+// ReleaseExpired receives the orders shipped more than ReleaseAfter ago on
+// behalf of their buyers, and returns how many it released. An order that
+// fails does not stop the others from being released.
+func (s EscrowService) ReleaseExpired(ctx context.Context) (int, error) {
+	shippedBefore := time.Now().Add(-s.ReleaseAfter).Format(domain.TimestampLayout)
+	orders, err := s.OrderRepo.GetUnreceivedOrders(ctx, shippedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	var errs jobErrors
+	for _, order := range orders {
+		err := s.TradeRepo.AdvanceOrder(ctx, order.ID, domain.OrderRelease)
+		if err == db.ErrInvalidOrderStatus {
+			// the buyer has received it in the meantime
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("order %d: %w", order.ID, err))
+			continue
+		}
+		released++
+
+		order.Status = domain.OrderStatusReceived
+		if err := s.AlertService.NotifyAdvanced(ctx, order, domain.OrderRelease); err != nil {
+			errs = append(errs, fmt.Errorf("notify order %d: %w", order.ID, err))
+		}
+		if err := s.AlertService.PublishBalance(ctx, order.SellerID); err != nil {
+			errs = append(errs, fmt.Errorf("notify order %d: %w", order.ID, err))
+		}
+	}
+	return released, errs.err()
+}
+
+// RefundUnshipped cancels the orders paid more than ShipWithin ago that have
+// not been shipped, refunds their buyers and returns how many it refunded.
+// An order that fails does not stop the others from being refunded.
+func (s EscrowService) RefundUnshipped(ctx context.Context) (int, error) {
+	paidBefore := time.Now().Add(-s.ShipWithin).Format(domain.TimestampLayout)
+	orders, err := s.OrderRepo.GetUnshippedOrders(ctx, paidBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	refunded := 0
+	var errs jobErrors
+	for _, order := range orders {
+		err := s.TradeRepo.CancelUnshipped(ctx, order.ID)
+		if err == db.ErrInvalidOrderStatus {
+			// shipped or cancelled in the meantime
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("order %d: %w", order.ID, err))
+			continue
+		}
+		refunded++
+
+		order.Status = domain.OrderStatusCancelled
+		if err := s.AlertService.NotifyParties(ctx, order, domain.NotificationTypeOrderCancelled, 0); err != nil {
+			errs = append(errs, fmt.Errorf("notify order %d: %w", order.ID, err))
+		}
+		if err := s.AlertService.PublishBalance(ctx, order.BuyerID); err != nil {
+			errs = append(errs, fmt.Errorf("notify order %d: %w", order.ID, err))
+		}
+	}
+	return refunded, errs.err()
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// EventBalance tells that the balance of the user has changed. Every other
+// event is a notification named after its type.
+const EventBalance = "balance"
+
+// StreamTicketTTL is how long a stream ticket can be redeemed after it is
+// issued.
+const StreamTicketTTL = 30 * time.Second
+
+// subscriptionBuffer is the number of events a stream can lag behind before
+// the hub drops events for it.
+const subscriptionBuffer = 16
+
+// Event is pushed to the streams of a user. Type is the name of the event,
+// and Data is encoded as JSON.
+type Event struct {
+	Type string
+	Data any
+}
+
+type ItemEvent struct {
+	ItemID int32 `json:"item_id"`
+}
+
+// BalanceEvent has the available balance of the user and the money of their
+// sales that is held in escrow.
+type BalanceEvent struct {
+	Balance int64 `json:"balance"`
+	Pending int64 `json:"pending"`
+}
+
+// NotificationEvent is the event of a notification that has just been added
+// to the inbox.
+func NotificationEvent(n domain.Notification) Event {
+	return Event{Type: string(n.Type), Data: ItemEvent{ItemID: n.ItemID}}
+}
+
+// Hub delivers events to the streams of each user within this process. A
+// user may have several streams open, e.g. in several tabs. Publishing never
+// blocks: a stream that does not keep up misses events, and clients are
+// expected to reload their state when they reconnect.
+type Hub struct {
+	mu      sync.Mutex
+	subs    map[int64]map[chan Event]struct{}
+	tickets map[string]streamTicket
+	closed  bool
+}
+
+// streamTicket lets a client open a stream without sending its token in the
+// URL, where it would end up in access logs.
+type streamTicket struct {
+	userID    int64
+	expiresAt time.Time
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[int64]map[chan Event]struct{}{}, tickets: map[string]streamTicket{}}
+}
+
+// IssueTicket returns a ticket that opens one stream of the user within
+// StreamTicketTTL.
+func (h *Hub) IssueTicket(userID int64) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(b)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for t, st := range h.tickets {
+		if now.After(st.expiresAt) {
+			delete(h.tickets, t)
+		}
+	}
+	h.tickets[ticket] = streamTicket{userID: userID, expiresAt: now.Add(StreamTicketTTL)}
+	return ticket, nil
+}
+
+// RedeemTicket returns the user of a ticket and forgets it, so that it can
+// only be used once. It returns false when the ticket is unknown or expired.
+func (h *Hub) RedeemTicket(ticket string) (int64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st, ok := h.tickets[ticket]
+	if !ok {
+		return 0, false
+	}
+	delete(h.tickets, ticket)
+	if time.Now().After(st.expiresAt) {
+		return 0, false
+	}
+	return st.userID, true
+}
+
+// Subscribe opens a stream of the events of the user. The channel is closed
+// by unsubscribe or when the hub is closed.
+func (h *Hub) Subscribe(userID int64) (events <-chan Event, unsubscribe func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Event, subscriptionBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs[userID] == nil {
+		h.subs[userID] = map[chan Event]struct{}{}
+	}
+	h.subs[userID][ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[userID][ch]; !ok {
+			return
+		}
+		delete(h.subs[userID], ch)
+		if len(h.subs[userID]) == 0 {
+			delete(h.subs, userID)
+		}
+		close(ch)
+	}
+}
+
+func (h *Hub) Publish(userID int64, e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[userID] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Close ends every stream, so that the server can shut down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, chans := range h.subs {
+		for ch := range chans {
+			close(ch)
+		}
+	}
+	h.subs = map[int64]map[chan Event]struct{}{}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRedeemTicket(t *testing.T) {
+	h := NewHub()
+	ticket, err := h.IssueTicket(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := h.IssueTicket(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := h.IssueTicket(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.tickets[expired] = streamTicket{userID: 3, expiresAt: time.Now().Add(-time.Second)}
+
+	tests := []struct {
+		name   string
+		ticket string
+		userID int64
+		ok     bool
+	}{
+		{"issued", ticket, 1, true},
+		{"used twice", ticket, 0, false},
+		{"of another user", other, 2, true},
+		{"expired", expired, 0, false},
+		{"unknown", "0123", 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, ok := h.RedeemTicket(tt.ticket)
+			if userID != tt.userID || ok != tt.ok {
+				t.Errorf("RedeemTicket() = %d, %t, want %d, %t", userID, ok, tt.userID, tt.ok)
+			}
+		})
+	}
+	if len(h.tickets) != 0 {
+		t.Errorf("%d tickets are left after redeeming them all", len(h.tickets))
+	}
+}
+
+func TestIssueTicketForgetsExpired(t *testing.T) {
+	h := NewHub()
+	h.tickets["stale"] = streamTicket{userID: 1, expiresAt: time.Now().Add(-time.Second)}
+	first, err1 := h.IssueTicket(1)
+	second, err2 := h.IssueTicket(1)
+	if err1 != nil || err2 != nil {
+		t.Fatal(err1, err2)
+	}
+	if first == second || len(first) != 64 {
+		t.Errorf("tickets %q and %q are not distinct random hex strings", first, second)
+	}
+	if _, ok := h.tickets["stale"]; ok || len(h.tickets) != 2 {
+		t.Errorf("tickets after issuing are %v", h.tickets)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	h := NewHub()
+	first, unsubscribeFirst := h.Subscribe(1)
+	second, unsubscribeSecond := h.Subscribe(1)
+	other, unsubscribeOther := h.Subscribe(2)
+	defer unsubscribeOther()
+
+	h.Publish(1, Event{Type: EventBalance})
+	for i, events := range []<-chan Event{first, second} {
+		if e := <-events; e.Type != EventBalance {
+			t.Errorf("stream %d got %+v", i, e)
+		}
+	}
+	select {
+	case e := <-other:
+		t.Errorf("stream of another user got %+v", e)
+	default:
+	}
+
+	// a stream that does not keep up misses events instead of blocking
+	for i := 0; i < subscriptionBuffer+1; i++ {
+		h.Publish(1, Event{Type: EventBalance})
+	}
+	if len(first) != subscriptionBuffer {
+		t.Errorf("stream has %d events, want %d", len(first), subscriptionBuffer)
+	}
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	for range first {
+	}
+	if len(h.subs[1]) != 1 {
+		t.Errorf("streams of the user after unsubscribing are %v", h.subs[1])
+	}
+	unsubscribeSecond()
+	if _, ok := h.subs[1]; ok {
+		t.Error("user without streams is still subscribed")
+	}
+}
+
+func TestClose(t *testing.T) {
+	h := NewHub()
+	events, unsubscribe := h.Subscribe(1)
+	h.Close()
+	if _, ok := <-events; ok {
+		t.Error("stream is open after closing the hub")
+	}
+	unsubscribe()
+
+	late, unsubscribe := h.Subscribe(1)
+	if _, ok := <-late; ok {
+		t.Error("stream opened after closing the hub is open")
+	}
+	unsubscribe()
+	h.Publish(1, Event{Type: EventBalance})
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/blobstore"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// DefaultImageSweepAfter is how long the blobs of a deleted image are kept
+// before they are swept, which leaves uploads of the same content running at
+// the time of the deletion enough time to refer to them.
+const DefaultImageSweepAfter = time.Hour
+
+// ImageService removes the blobs of deleted images from the image store once
+// no image refers to them anymore. The store is content addressed, so images
+// of other items may share the blobs.
+type ImageService struct {
+	ImageRepo  db.ItemImageRepository
+	ImageStore blobstore.Store
+	SweepAfter time.Duration
+}
+
+func NewImageService(sqlDB *db.DB, imageStore blobstore.Store, sweepAfter time.Duration) ImageService {
+	return ImageService{
+		ImageRepo:  db.NewItemImageRepository(sqlDB),
+		ImageStore: imageStore,
+		SweepAfter: sweepAfter,
+	}
+}
+
+// SweepDeleted deletes the unused blobs of the images deleted more than
+// SweepAfter ago, and returns how many it deleted. A blob that fails does not
+// stop the others from being swept.
+func (s ImageService) SweepDeleted(ctx context.Context) (int, error) {
+	deletedBefore := time.Now().Add(-s.SweepAfter).Format(domain.TimestampLayout)
+	keys, err := s.ImageRepo.GetDeletedImageKeys(ctx, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	swept := 0
+	var errs jobErrors
+	for _, key := range keys {
+		deleted, err := s.ImageRepo.SweepImageKey(ctx, s.ImageStore, key, deletedBefore)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("image %s: %w", key, err))
+			continue
+		}
+		if deleted {
+			swept++
+		}
+	}
+	return swept, errs.err()
+}
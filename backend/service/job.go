@@ -0,0 +1,23 @@
+package service
+
+import "strings"
+
+// jobErrors collects the errors of a background job that goes on past them,
+// so that one failing order, hold or auction does not hold back the others.
+type jobErrors []error
+
+func (e jobErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// err returns the collected errors, or nil when there are none.
+func (e jobErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+// DefaultOfferHold is how long an accepted offer reserves the item for the
+// buyer.
+const DefaultOfferHold = 24 * time.Hour
+
+type OfferService struct {
+	ItemRepo  db.ItemRepository
+	OfferRepo db.OfferRepository
+	HoldFor   time.Duration
+}
+
+var ErrNotOfferParty = errors.New("can not see other's offer")
+
+func NewOfferService(sqlDB *db.DB, holdFor time.Duration) OfferService {
+	return OfferService{
+		ItemRepo:  db.NewItemRepository(sqlDB),
+		OfferRepo: db.NewOfferRepository(sqlDB),
+		HoldFor:   holdFor,
+	}
+}
+
+// MakeOffer offers the seller of an item on sale to buy it at a lower price.
+// The status and the price of the item are checked by OfferRepo.AddOffer.
+func (s OfferService) MakeOffer(ctx context.Context, buyerID int64, itemID int32, price int64) (domain.Offer, error) {
+	item, err := s.ItemRepo.GetItem(ctx, itemID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Offer{}, ErrItemNotFound
+		}
+		return domain.Offer{}, err
+	}
+	if item.UserID == buyerID {
+		return domain.Offer{}, ErrOwnItem
+	}
+
+	offer := domain.Offer{
+		ItemID:   itemID,
+		ItemName: item.Name,
+		BuyerID:  buyerID,
+		SellerID: item.UserID,
+		Price:    price,
+		Status:   domain.OfferStatusPending,
+	}
+	offer.ID, err = s.OfferRepo.AddOffer(ctx, offer)
+	return offer, err
+}
+
+// GetOffer returns an offer the user is a party to.
+func (s OfferService) GetOffer(ctx context.Context, userID, offerID int64) (domain.Offer, error) {
+	offer, err := s.OfferRepo.GetOffer(ctx, offerID)
+	if err != nil {
+		return domain.Offer{}, err
+	}
+	if offer.Role(userID) == "" {
+		return domain.Offer{}, ErrNotOfferParty
+	}
+	return offer, nil
+}
+
+// getAnswerable returns an offer the user has to answer. It returns
+// ErrWrongParty when the other party has to answer it, and
+// db.ErrInvalidOfferStatus when the negotiation is over.
+func (s OfferService) getAnswerable(ctx context.Context, userID, offerID int64) (domain.Offer, error) {
+	offer, err := s.GetOffer(ctx, userID, offerID)
+	if err != nil {
+		return domain.Offer{}, err
+	}
+	awaiting := offer.Status.Awaiting()
+	if awaiting == "" {
+		return domain.Offer{}, db.ErrInvalidOfferStatus
+	}
+	if offer.Role(userID) != awaiting {
+		return domain.Offer{}, ErrWrongParty
+	}
+	return offer, nil
+}
+
+// Accept agrees to the price of an offer, which reserves the item for the
+// buyer for HoldFor.
+func (s OfferService) Accept(ctx context.Context, userID, offerID int64) (domain.Offer, error) {
+	offer, err := s.getAnswerable(ctx, userID, offerID)
+	if err != nil {
+		return domain.Offer{}, err
+	}
+	expiresAt := time.Now().Add(s.HoldFor).Format(domain.TimestampLayout)
+	if err := s.OfferRepo.AcceptOffer(ctx, offerID, offer.Status, expiresAt); err != nil {
+		return domain.Offer{}, err
+	}
+	offer.Status = domain.OfferStatusAccepted
+	offer.ExpiresAt = expiresAt
+	return offer, nil
+}
+
+// Reject ends the negotiation of an offer.
+func (s OfferService) Reject(ctx context.Context, userID, offerID int64) (domain.Offer, error) {
+	offer, err := s.getAnswerable(ctx, userID, offerID)
+	if err != nil {
+		return domain.Offer{}, err
+	}
+	if err := s.OfferRepo.AnswerOffer(ctx, offerID, offer.Status, domain.OfferStatusRejected, offer.Price); err != nil {
+		return domain.Offer{}, err
+	}
+	offer.Status = domain.OfferStatusRejected
+	return offer, nil
+}
+
+// Counter proposes another price for an offer, which the other party has to
+// answer in turn.
+func (s OfferService) Counter(ctx context.Context, userID, offerID int64, price int64) (domain.Offer, error) {
+	offer, err := s.getAnswerable(ctx, userID, offerID)
+	if err != nil {
+		return domain.Offer{}, err
+	}
+	to := domain.OfferStatusCountered
+	if offer.Role(userID) == domain.OrderRoleBuyer {
+		to = domain.OfferStatusPending
+	}
+	if err := s.OfferRepo.AnswerOffer(ctx, offerID, offer.Status, to, price); err != nil {
+		return domain.Offer{}, err
+	}
+	offer.Status = to
+	offer.Price = price
+	return offer, nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+type OrderService struct {
+	OrderRepo        db.OrderRepository
+	TradeRepo        db.TradeRepository
+	CancellationRepo db.CancellationRepository
+	ReviewRepo       db.ReviewRepository
+}
+
+var (
+	ErrNotOrderParty = errors.New("can not see other's order")
+	ErrWrongParty    = errors.New("the other party has to do this")
+)
+
+func NewOrderService(sqlDB *db.DB) OrderService {
+	return OrderService{
+		OrderRepo:        db.NewOrderRepository(sqlDB),
+		TradeRepo:        db.NewTradeRepository(sqlDB),
+		CancellationRepo: db.NewCancellationRepository(sqlDB),
+		ReviewRepo:       db.NewReviewRepository(sqlDB),
+	}
+}
+
+// GetOrder returns an order the user is a party to.
+func (s OrderService) GetOrder(ctx context.Context, userID, orderID int64) (domain.Order, error) {
+	order, err := s.OrderRepo.GetOrder(ctx, orderID)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if order.Role(userID) == "" {
+		return domain.Order{}, ErrNotOrderParty
+	}
+	return order, nil
+}
+
+// Advance makes the transition t on an order for the user, and returns the
+// order after it. It returns ErrWrongParty when t is not up to the user, and
+// db.ErrInvalidOrderStatus when the order is not in t.From.
+func (s OrderService) Advance(ctx context.Context, userID, orderID int64, t domain.OrderTransition) (domain.Order, error) {
+	order, err := s.GetOrder(ctx, userID, orderID)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if order.Role(userID) != t.By {
+		return domain.Order{}, ErrWrongParty
+	}
+	if order.Status != t.From {
+		return domain.Order{}, db.ErrInvalidOrderStatus
+	}
+
+	if err := s.TradeRepo.AdvanceOrder(ctx, orderID, t); err != nil {
+		return domain.Order{}, err
+	}
+	order.Status = t.To
+	return order, nil
+}
+
+// RequestCancellation asks the other party of an order to cancel it. It
+// returns db.ErrInvalidOrderStatus when the money of the order is not held
+// anymore.
+func (s OrderService) RequestCancellation(ctx context.Context, userID, orderID int64, reason string) (domain.Order, error) {
+	order, err := s.GetOrder(ctx, userID, orderID)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if !order.Status.Held() {
+		return domain.Order{}, db.ErrInvalidOrderStatus
+	}
+
+	_, err = s.CancellationRepo.AddCancellation(ctx, domain.Cancellation{OrderID: orderID, RequestedBy: userID, Reason: reason})
+	return order, err
+}
+
+// ResolveCancellation approves or rejects the requested cancellation of an
+// order, and returns the order with the cancellation. Only the party who did
+// not request it can resolve it.
+func (s OrderService) ResolveCancellation(ctx context.Context, userID, orderID int64, approve bool) (domain.Order, domain.Cancellation, error) {
+	order, err := s.GetOrder(ctx, userID, orderID)
+	if err != nil {
+		return domain.Order{}, domain.Cancellation{}, err
+	}
+	cancellation, err := s.CancellationRepo.GetLatestCancellation(ctx, orderID)
+	if err == db.ErrCancellationNotFound || (err == nil && cancellation.Status != domain.CancellationStatusRequested) {
+		return domain.Order{}, domain.Cancellation{}, db.ErrCancellationNotRequested
+	}
+	if err != nil {
+		return domain.Order{}, domain.Cancellation{}, err
+	}
+	if cancellation.RequestedBy == userID {
+		return domain.Order{}, domain.Cancellation{}, ErrWrongParty
+	}
+
+	if !approve {
+		cancellation.Status = domain.CancellationStatusRejected
+		return order, cancellation, s.CancellationRepo.RejectCancellation(ctx, cancellation.ID)
+	}
+	if err := s.TradeRepo.ApproveCancellation(ctx, cancellation.ID, userID); err != nil {
+		return domain.Order{}, domain.Cancellation{}, err
+	}
+	order.Status = domain.OrderStatusCancelled
+	cancellation.Status = domain.CancellationStatusApproved
+	return order, cancellation, nil
+}
+
+// ForceRefund cancels an order on behalf of an admin, whether or not a party
+// has requested it.
+func (s OrderService) ForceRefund(ctx context.Context, adminID, orderID int64, reason string) (domain.Order, error) {
+	order, err := s.OrderRepo.GetOrder(ctx, orderID)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if err := s.TradeRepo.ForceRefund(ctx, orderID, adminID, reason); err != nil {
+		return domain.Order{}, err
+	}
+	order.Status = domain.OrderStatusCancelled
+	return order, nil
+}
+
+// Review adds the review of the user about the other party of an order. It
+// returns db.ErrInvalidOrderStatus until the order has been received.
+func (s OrderService) Review(ctx context.Context, userID, orderID int64, rating domain.Rating, comment string) (domain.Review, error) {
+	order, err := s.GetOrder(ctx, userID, orderID)
+	if err != nil {
+		return domain.Review{}, err
+	}
+	if !order.Reviewable() {
+		return domain.Review{}, db.ErrInvalidOrderStatus
+	}
+
+	review := domain.Review{
+		OrderID:    orderID,
+		ItemID:     order.ItemID,
+		ReviewerID: userID,
+		RevieweeID: order.BuyerID,
+		Rating:     rating,
+		Comment:    comment,
+	}
+	if userID == order.BuyerID {
+		review.RevieweeID = order.SellerID
+	}
+	review.ID, err = s.ReviewRepo.AddReview(ctx, review)
+	return review, err
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+)
+
+type PurchaseService struct {
+	ItemRepo  db.ItemRepository
+	TradeRepo db.TradeRepository
+}
+
+var (
+	ErrItemNotFound = errors.New("item not found")
+	ErrOwnItem      = errors.New("can not buy own items")
+)
+
+func NewPurchaseService(sqlDB *db.DB) PurchaseService {
+	return PurchaseService{
+		ItemRepo:  db.NewItemRepository(sqlDB),
+		TradeRepo: db.NewTradeRepository(sqlDB),
+	}
+}
+
+// Purchase debits the buyer, marks the item as sold out and opens an order
+// atomically. It returns db.ErrItemNotOnSale or db.ErrInsufficientBalance when
+// the trade can not be made.
+func (s PurchaseService) Purchase(ctx context.Context, buyerID int64, itemID int32) (int64, error) {
+	item, err := s.ItemRepo.GetItem(ctx, itemID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrItemNotFound
+		}
+		return 0, err
+	}
+	if item.UserID == buyerID {
+		return 0, ErrOwnItem
+	}
+
+	return s.TradeRepo.Purchase(ctx, buyerID, itemID)
+}
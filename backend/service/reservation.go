@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/db"
+	"github.com/kotapiku/mercari-build-hackathon-2023/backend/domain"
+)
+
+const (
+	// DefaultReservationHold is how long a buyer can hold an item before
+	// purchasing it.
+	DefaultReservationHold = 30 * time.Minute
+	// DefaultReservationCooldown is how long a buyer has to wait before
+	// holding an item again after their hold on it ended.
+	DefaultReservationCooldown = 2 * time.Hour
+	// DefaultMaxReservations is how many items a buyer can hold at once.
+	DefaultMaxReservations = 3
+)
+
+// ReservationService holds items on sale for buyers, and releases the holds
+// that have expired.
+type ReservationService struct {
+	ItemRepo        db.ItemRepository
+	UserRepo        db.UserRepository
+	ReservationRepo db.ReservationRepository
+	AlertService    AlertService
+	HoldFor         time.Duration
+	Cooldown        time.Duration
+	MaxHolds        int
+}
+
+var ErrNotReservationHolder = errors.New("item is not reserved for the user")
+
+func NewReservationService(sqlDB *db.DB, alertService AlertService, holdFor, cooldown time.Duration, maxHolds int) ReservationService {
+	return ReservationService{
+		ItemRepo:        db.NewItemRepository(sqlDB),
+		UserRepo:        db.NewUserRepository(sqlDB),
+		ReservationRepo: db.NewReservationRepository(sqlDB),
+		AlertService:    alertService,
+		HoldFor:         holdFor,
+		Cooldown:        cooldown,
+		MaxHolds:        maxHolds,
+	}
+}
+
+// Reserve holds an item on sale for the buyer for HoldFor. The buyer has to
+// be able to pay the item, must not hold MaxHolds items already, and can not
+// hold the same item again for Cooldown after their last hold on it ended,
+// so that nobody keeps an item off the market by holding it over and over.
+func (s ReservationService) Reserve(ctx context.Context, buyerID int64, itemID int32) (domain.Reservation, error) {
+	item, err := s.ItemRepo.GetItem(ctx, itemID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Reservation{}, ErrItemNotFound
+		}
+		return domain.Reservation{}, err
+	}
+	if item.UserID == buyerID {
+		return domain.Reservation{}, ErrOwnItem
+	}
+	buyer, err := s.UserRepo.GetUser(ctx, buyerID)
+	if err != nil {
+		return domain.Reservation{}, err
+	}
+	if buyer.Balance < item.Price {
+		return domain.Reservation{}, db.ErrInsufficientBalance
+	}
+
+	now := time.Now()
+	limits := db.ReservationLimits{MaxActive: s.MaxHolds}
+	if s.Cooldown > 0 {
+		limits.CooldownSince = now.Add(-s.Cooldown).Format(domain.TimestampLayout)
+	}
+	expiresAt := now.Add(s.HoldFor).Format(domain.TimestampLayout)
+	return s.ReservationRepo.Reserve(ctx, itemID, buyerID, expiresAt, limits)
+}
+
+// Release gives up the hold of the buyer on an item, which goes back on sale.
+func (s ReservationService) Release(ctx context.Context, buyerID int64, itemID int32) error {
+	reservation, err := s.ReservationRepo.GetActiveReservation(ctx, itemID)
+	if err == db.ErrReservationNotFound || (err == nil && reservation.BuyerID != buyerID) {
+		return ErrNotReservationHolder
+	}
+	if err != nil {
+		return err
+	}
+	return s.ReservationRepo.ReleaseReservation(ctx, reservation.ID, domain.ReservationStatusReleased)
+}
+
+// ReleaseExpired puts the items whose holds have expired back on sale, tells
+// the buyers who held them, and returns how many it released. A hold that
+// fails does not stop the others from being released.
+func (s ReservationService) ReleaseExpired(ctx context.Context) (int, error) {
+	reservations, err := s.ReservationRepo.GetExpiredReservations(ctx, time.Now().Format(domain.TimestampLayout))
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	var errs jobErrors
+	for _, reservation := range reservations {
+		err := s.ReservationRepo.ReleaseReservation(ctx, reservation.ID, domain.ReservationStatusExpired)
+		if err == db.ErrReservationNotActive {
+			// purchased or released in the meantime
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reservation %d: %w", reservation.ID, err))
+			continue
+		}
+		released++
+
+		err = s.AlertService.Notify(ctx, []domain.Notification{{UserID: reservation.BuyerID, Type: domain.NotificationTypeReservationExpired, ItemID: reservation.ItemID}})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("notify reservation %d: %w", reservation.ID, err))
+		}
+	}
+	return released, errs.err()
+}
@@ -0,0 +1,95 @@
+package textsearch
+
+import (
+	"strings"
+	"unicode"
+)
+
+// snippetContext is the number of characters shown before the first match.
+const snippetContext = 30
+
+// Highlight returns an excerpt of text around the first match of query, with
+// every match enclosed in open and close. Matching works on normalized text,
+// so "ｶﾒﾗ" in text is highlighted for the query "かめら". It returns "" when
+// query does not occur in text.
+func Highlight(text, query, open, close string) string {
+	runes := []rune(text)
+
+	// normalize every character with its combining marks separately, keeping
+	// where each normalized rune comes from
+	var normalized []rune
+	var origin []int
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && (unicode.Is(unicode.M, runes[j]) || runes[j] == 'ﾞ' || runes[j] == 'ﾟ') {
+			j++
+		}
+		for _, r := range Normalize(string(runes[i:j])) {
+			normalized = append(normalized, r)
+			origin = append(origin, i)
+		}
+		i = j
+	}
+
+	// marks[i] is the end of the longest match starting at rune i of text
+	marks := make([]int, len(runes)+1)
+	first := -1
+	for _, seg := range segments(Normalize(query)) {
+		needle := []rune(seg.text)
+		for i := 0; i+len(needle) <= len(normalized); i++ {
+			if string(normalized[i:i+len(needle)]) != seg.text {
+				continue
+			}
+			start := origin[i]
+			end := len(runes)
+			if k := i + len(needle); k < len(normalized) {
+				end = origin[k]
+			}
+			if end <= start {
+				continue
+			}
+			if end > marks[start] {
+				marks[start] = end
+			}
+			if first < 0 || start < first {
+				first = start
+			}
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	start, end := first-snippetContext, first+snippetContext*2
+	if start <= 0 {
+		start = 0
+	} else {
+		b.WriteString("…")
+	}
+	if end > len(runes) {
+		end = len(runes)
+	}
+	for i := start; i < end; i++ {
+		if marks[i] > i {
+			j := marks[i]
+			// extend over overlapping matches
+			for k := i + 1; k < j && k < len(runes); k++ {
+				if marks[k] > j {
+					j = marks[k]
+				}
+			}
+			if j > end {
+				j = end
+			}
+			b.WriteString(open + string(runes[i:j]) + close)
+			i = j - 1
+			continue
+		}
+		b.WriteRune(runes[i])
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,174 @@
+// Package textsearch normalizes and tokenizes item text for search, so that
+// full-width and half-width characters, katakana and hiragana, and upper and
+// lower case all match each other. Text in CJK scripts has no spaces between
+// words and is indexed as overlapping bigrams, which lets a query match any
+// part of a word.
+package textsearch
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+var folder = cases.Fold()
+
+// Normalize applies NFKC, case folding and kana folding to s.
+func Normalize(s string) string {
+	s = folder.String(norm.NFKC.String(s))
+	return strings.Map(foldKana, s)
+}
+
+// foldKana maps katakana to the corresponding hiragana.
+func foldKana(r rune) rune {
+	switch {
+	case r >= 'ァ' && r <= 'ヶ', r == 'ヽ', r == 'ヾ':
+		return r - ('ァ' - 'ぁ')
+	}
+	return r
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || r == 'ー' || r == '々'
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r)
+}
+
+// segment is a word or a run of CJK characters of normalized text.
+type segment struct {
+	text string
+	cjk  bool
+}
+
+func segments(normalized string) []segment {
+	var segs []segment
+	var cur []rune
+	cjk := false
+	flush := func() {
+		if len(cur) > 0 {
+			segs = append(segs, segment{text: string(cur), cjk: cjk})
+			cur = cur[:0]
+		}
+	}
+	for _, r := range normalized {
+		switch {
+		case isCJK(r):
+			if !cjk {
+				flush()
+			}
+			cjk = true
+		case isWord(r):
+			if cjk {
+				flush()
+			}
+			cjk = false
+		default:
+			flush()
+			continue
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return segs
+}
+
+func bigrams(run string) []string {
+	runes := []rune(run)
+	if len(runes) < 2 {
+		return []string{run}
+	}
+	grams := make([]string, 0, len(runes)-1)
+	for i := 0; i+1 < len(runes); i++ {
+		grams = append(grams, string(runes[i:i+2]))
+	}
+	return grams
+}
+
+// IndexText returns the tokens of s separated by spaces. A CJK run is indexed
+// as its bigrams followed by its last character, so that every character
+// starts a token.
+func IndexText(s string) string {
+	var tokens []string
+	for _, seg := range segments(Normalize(s)) {
+		if !seg.cjk {
+			tokens = append(tokens, seg.text)
+			continue
+		}
+		tokens = append(tokens, bigrams(seg.text)...)
+		if runes := []rune(seg.text); len(runes) > 1 {
+			tokens = append(tokens, string(runes[len(runes)-1:]))
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// Term is one part of a query. Its tokens have to occur one after another in
+// the IndexText of an item, and the last one only as a prefix when Prefix is
+// true.
+type Term struct {
+	Tokens []string
+	Prefix bool
+}
+
+// Phrase returns the tokens as they occur in the IndexText.
+func (t Term) Phrase() string {
+	return strings.Join(t.Tokens, " ")
+}
+
+// Query splits a search query into terms that all have to match. Words and
+// single CJK characters match as prefixes, longer CJK runs as a phrase of
+// bigrams.
+func Query(s string) []Term {
+	var terms []Term
+	for _, seg := range segments(Normalize(s)) {
+		if seg.cjk && len([]rune(seg.text)) > 1 {
+			terms = append(terms, Term{Tokens: bigrams(seg.text)})
+		} else {
+			terms = append(terms, Term{Tokens: []string{seg.text}, Prefix: true})
+		}
+	}
+	return terms
+}
+
+// Match reports whether every term of query matches one of texts, the same
+// way a search of the IndexText of texts does.
+func Match(query string, texts ...string) bool {
+	indexed := make([][]string, 0, len(texts))
+	for _, text := range texts {
+		indexed = append(indexed, strings.Fields(IndexText(text)))
+	}
+	for _, term := range Query(query) {
+		found := false
+		for _, tokens := range indexed {
+			if term.matches(tokens) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (t Term) matches(tokens []string) bool {
+	last := len(t.Tokens) - 1
+	for i := 0; i+last < len(tokens); i++ {
+		ok := true
+		for j, token := range t.Tokens {
+			if tokens[i+j] != token && !(t.Prefix && j == last && strings.HasPrefix(tokens[i+j], token)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package textsearch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"ascii case", "Camera", "camera"},
+		{"full width", "ＣＡＭＥＲＡ１２３", "camera123"},
+		{"half width katakana", "ｶﾒﾗ", "かめら"},
+		{"half width voiced katakana", "ﾃﾞｼﾞｶﾒ", "でじかめ"},
+		{"katakana", "カメラ", "かめら"},
+		{"iteration marks", "ヽヾ", "ゝゞ"},
+		{"long vowel mark is kept", "コーヒー", "こーひー"},
+		{"kanji are kept", "時計", "時計"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"words", "Vintage  Camera!", "vintage camera"},
+		{"cjk bigrams", "腕時計", "腕時 時計 計"},
+		{"single cjk character", "本", "本"},
+		{"mixed scripts", "iPhoneケース", "iphone けー ーす す"},
+		{"empty", " ,.", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IndexText(tt.in); got != tt.want {
+				t.Errorf("IndexText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Term
+	}{
+		{"words are prefixes", "old CAMERA", []Term{
+			{Tokens: []string{"old"}, Prefix: true},
+			{Tokens: []string{"camera"}, Prefix: true},
+		}},
+		{"cjk runs are phrases of bigrams", "腕時計", []Term{
+			{Tokens: []string{"腕時", "時計"}},
+		}},
+		{"single cjk character is a prefix", "本", []Term{
+			{Tokens: []string{"本"}, Prefix: true},
+		}},
+		{"mixed scripts", "ｶﾒﾗ bag", []Term{
+			{Tokens: []string{"かめ", "めら"}},
+			{Tokens: []string{"bag"}, Prefix: true},
+		}},
+		{"empty", "  ", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Query(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		texts []string
+		want  bool
+	}{
+		{"prefix of a word", "cam", []string{"Vintage Camera"}, true},
+		{"middle of a word", "amera", []string{"Vintage Camera"}, false},
+		{"every term has to match", "camera lens", []string{"Vintage Camera"}, false},
+		{"terms match any text", "camera lens", []string{"Vintage Camera", "with a lens"}, true},
+		{"width and kana folding", "かめら", []string{"ｶﾒﾗ"}, true},
+		{"part of a cjk word", "時計", []string{"腕時計"}, true},
+		{"last cjk character", "計", []string{"腕時計"}, true},
+		{"cjk phrase out of order", "計時", []string{"腕時計"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.query, tt.texts...); got != tt.want {
+				t.Errorf("Match(%q, %q) = %t, want %t", tt.query, tt.texts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	long := strings.Repeat("x", 40) + " camera " + strings.Repeat("y", 80)
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  string
+	}{
+		{"word", "Vintage Camera", "camera", "Vintage [Camera]"},
+		{"every match", "camera and camera", "camera", "[camera] and [camera]"},
+		{"several terms", "old camera bag", "bag old", "[old] camera [bag]"},
+		{"half width katakana", "ｶﾒﾗ ケース", "かめら", "[ｶﾒﾗ] ケース"},
+		{"overlapping matches", "腕時計", "腕時 時計", "[腕時計]"},
+		{"no match", "Vintage Camera", "lens", ""},
+		{"excerpt", long, "camera", "…" + strings.Repeat("x", 29) + " [camera] " + strings.Repeat("y", 53) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Highlight(tt.text, tt.query, "[", "]"); got != tt.want {
+				t.Errorf("Highlight(%q, %q) = %q, want %q", tt.text, tt.query, got, tt.want)
+			}
+		})
+	}
+}